@@ -6,12 +6,13 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"strconv"
+	"strings"
 
 	"github.com/diamondburned/arikawa/v3/utils/bot"
 	"github.com/diamondburned/arikawa/v3/gateway"
 	minio "github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"samhza.com/esammy/memegen"
 	"samhza.com/esammy/tenor"
 	"samhza.com/esammy/vedit"
 	ff "samhza.com/ffmpeg"
@@ -25,6 +26,8 @@ type Bot struct {
 	httpClient *http.Client
 	tenor      *tenor.Client
 	s3         *minio.Client
+	music      vedit.MusicResolver
+	templates  map[string]*memegen.Template
 }
 
 type Config struct {
@@ -35,6 +38,33 @@ type Config struct {
 	S3KeyID     string `toml:"s3-key-id"`
 	S3SecretKey string `toml:"s3-secret-key"`
 	S3Bucket    string `toml:"s3-bucket"`
+
+	// MusicResolvers lists the music backends to try, in order. Valid
+	// backends are "library", "yt-dlp" and "youtube".
+	MusicResolvers []string `toml:"music-resolvers"`
+	MusicLibrary   string   `toml:"music-library"`
+	MusicCache     string   `toml:"music-cache"`
+
+	// Loudness is the default target loudness of outputs in LUFS. Zero
+	// disables loudness normalization.
+	Loudness float64                `toml:"loudness"`
+	Guilds   map[string]GuildConfig `toml:"guilds"`
+
+	// Templates is the directory meme templates are loaded from.
+	Templates string `toml:"templates"`
+	// EmojiDir is a directory of Twemoji-style emoji images, named after
+	// their codepoints like "1f600.png". If empty, the images bundled with
+	// memegen are used.
+	EmojiDir string `toml:"emoji-dir"`
+	// FallbackFonts lists TrueType font files used for characters missing
+	// from the fonts of memes, by font style: "impact", "caption" or
+	// "times". The fonts under "all" are used for every style.
+	FallbackFonts map[string][]string `toml:"fallback-fonts"`
+	// FontVariants are TrueType font files for the bold and italic
+	// variants of the fonts of memes, keyed by the style and variant, like
+	// "caption bold" or "caption bold italic". Variants without a font are
+	// synthesized.
+	FontVariants map[string]string `toml:"font-variants"`
 }
 
 func New(client *http.Client, cfg Config) *Bot {
@@ -54,9 +84,97 @@ func New(client *http.Client, cfg Config) *Bot {
 			panic(err)
 		}
 	}
+	music, err := newMusicResolver(client, cfg)
+	if err != nil {
+		panic(err)
+	}
+	b.music = music
+	memegen.Emojis = newEmojiSource(client, cfg.EmojiDir)
+	for style, paths := range cfg.FallbackFonts {
+		if style == "all" {
+			style = ""
+		}
+		for _, path := range paths {
+			if err = memegen.LoadFallbackFont(style, path); err != nil {
+				panic(err)
+			}
+		}
+	}
+	for name, path := range cfg.FontVariants {
+		style, v, err := parseFontVariant(name)
+		if err == nil {
+			err = memegen.LoadFontVariant(style, v, path)
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+	if cfg.Templates != "" {
+		b.templates, err = memegen.LoadTemplates(os.DirFS(cfg.Templates))
+		if err != nil {
+			panic(err)
+		}
+	}
 	return &b
 }
 
+// parseFontVariant parses a font style followed by "bold" and/or "italic".
+func parseFontVariant(s string) (string, memegen.Variant, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return "", 0, fmt.Errorf("invalid font variant %q", s)
+	}
+	var v memegen.Variant
+	for _, f := range fields[1:] {
+		switch f {
+		case "bold":
+			v |= memegen.Bold
+		case "italic":
+			v |= memegen.Italic
+		default:
+			return "", 0, fmt.Errorf("invalid font variant %q", s)
+		}
+	}
+	return fields[0], v, nil
+}
+
+func newMusicResolver(client *http.Client, cfg Config) (vedit.MusicResolver, error) {
+	names := cfg.MusicResolvers
+	if len(names) == 0 {
+		names = []string{"yt-dlp", "youtube"}
+		if cfg.MusicLibrary != "" {
+			names = append([]string{"library"}, names...)
+		}
+	}
+	var chain vedit.ChainResolver
+	for _, name := range names {
+		switch name {
+		case "library":
+			if cfg.MusicLibrary == "" {
+				return nil, errors.New("music library resolver needs music-library to be set")
+			}
+			chain = append(chain, &vedit.LibraryResolver{Dir: cfg.MusicLibrary})
+		case "yt-dlp":
+			chain = append(chain, vedit.YTDLPResolver{})
+		case "youtube":
+			chain = append(chain, vedit.YouTubeResolver{})
+		default:
+			return nil, fmt.Errorf("unknown music resolver %q", name)
+		}
+	}
+	if cfg.MusicCache == "" {
+		return chain, nil
+	}
+	if err := os.MkdirAll(cfg.MusicCache, 0755); err != nil {
+		return nil, err
+	}
+	return &vedit.CachedResolver{
+		Resolver: chain,
+		Dir:      cfg.MusicCache,
+		Client:   client,
+	}, nil
+}
+
 func (b *Bot) Ping(m *gateway.MessageCreateEvent) error {
 	msg, err := b.Ctx.SendMessage(m.ChannelID, "Pong!")
 	if err != nil {
@@ -143,73 +261,15 @@ func (bot *Bot) Edit(m *gateway.MessageCreateEvent, cmd editArguments) error {
 	if err != nil {
 		return err
 	}
-	err = vedit.Process(args, itype, in, out.File)
-	if err != nil {
-		return err
-	}
-	done()
-	return out.Send(bot.Ctx.Client, m.ChannelID)
-}
-
-func (bot *Bot) Concat(m *gateway.MessageCreateEvent, args ...string) error {
-	var cliplen []int
-	for _, arg := range args {
-		n, err := strconv.Atoi(arg)
-		if err != nil {
-			break
-		}
-		cliplen = append(cliplen, n)
-	}
-	fmt.Println(cliplen)
-	clips := args[len(cliplen):]
-	for _, att := range m.Attachments {
-		clips = append(clips, att.Proxy)
-	}
-	if len(clips) < 2 {
-		return errors.New("need at least 2 videos")
-	}
-	probed, err := ff.Probe(clips[0])
-	width, height := -1, -1
-	for _, stream := range probed.Streams {
-		if stream.CodecType == ff.CodecTypeVideo {
-			width = stream.Width
-			height = stream.Height
-			break
-		}
-	}
-	done := bot.startWorking(m.ChannelID, m.ID)
-	defer done()
-	out, err := bot.createOutput(m.ID, "combined", ".mp4")
+	err = vedit.Process(args, itype, in, out.File, bot.music)
 	if err != nil {
 		return err
 	}
-	var inputs []ff.Stream
-	for i, arg := range clips {
-		input := ff.Input{Name: arg}
-		scaled := ff.Filter(ff.Video(input),
-			fmt.Sprintf("scale=%d:%d", width, height),
-		)
-		if i+1 <= len(cliplen) {
-			n := strconv.Itoa(cliplen[i])
-			inputs = append(inputs,
-				ff.Filter(scaled,
-					"trim=duration="+n),
-				ff.Filter(ff.Audio(input),
-					"atrim=duration="+n))
-		} else {
-			inputs = append(inputs, scaled, ff.Audio(input))
+	if args.Normalize() {
+		if err = bot.normalize(out, m.GuildID); err != nil {
+			return err
 		}
 	}
-	outs := ff.Concat(1, 1, inputs...)
-	fcmd := new(ff.Cmd)
-	if err != nil {
-		return err
-	}
-	fcmd.AddFileOutput(out.File, []string{"-y", "-f", "mp4"}, outs...)
-	err = fcmd.Cmd().Run()
-	if err != nil {
-		return err
-	}
 	done()
 	return out.Send(bot.Ctx.Client, m.ChannelID)
 }
@@ -0,0 +1,209 @@
+package discordbot
+
+import (
+	"errors"
+	"fmt"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/bot/extras/arguments"
+	"samhza.com/esammy/memegen"
+	"samhza.com/esammy/vedit"
+)
+
+const (
+	// maxCompilationClips is the most clips a compilation can have.
+	maxCompilationClips = 25
+	// maxCompilationScan is the most messages that are looked through to
+	// find clips for a compilation.
+	maxCompilationScan = 500
+
+	compilationWidth  = 1280
+	compilationHeight = 720
+	// titleCardDuration is how long title cards are shown, in seconds.
+	titleCardDuration = 1.5
+	// defaultCompilationLoudness is the loudness in LUFS clips are
+	// normalized to if the guild has no loudness target, since clips from
+	// different places are rarely anywhere near as loud as each other.
+	defaultCompilationLoudness = -16
+)
+
+type compilationArguments struct {
+	n      int
+	user   discord.UserID
+	since  time.Duration
+	nobot  bool
+	titles bool
+	nonorm bool
+}
+
+// parse parses the arguments to Compilation: the number of clips, a user
+// mention to only include that user's clips, a duration like "24h" to only
+// include clips posted within it, "nobot" to skip the bot's own outputs and
+// "titles" to show who posted each clip before it.
+func (c *compilationArguments) parse(args []string) error {
+	c.n = 8
+	for _, arg := range args {
+		if n, err := strconv.Atoi(arg); err == nil {
+			if n < 2 || n > maxCompilationClips {
+				return fmt.Errorf("number of clips must be between 2 and %d",
+					maxCompilationClips)
+			}
+			c.n = n
+			continue
+		}
+		if d, err := time.ParseDuration(arg); err == nil {
+			c.since = d
+			continue
+		}
+		var mention arguments.UserMention
+		if err := mention.Parse(arg); err == nil {
+			c.user = mention.ID()
+			continue
+		}
+		switch arg {
+		case "nobot":
+			c.nobot = true
+		case "titles":
+			c.titles = true
+		case "nonorm":
+			c.nonorm = true
+		default:
+			return fmt.Errorf("unknown argument %q", arg)
+		}
+	}
+	return nil
+}
+
+type compilationClip struct {
+	media  *Media
+	author discord.User
+}
+
+// Compilation concatenates the most recent videos and GIFs posted in the
+// channel.
+func (bot *Bot) Compilation(m *gateway.MessageCreateEvent, args ...string) error {
+	var cargs compilationArguments
+	if err := cargs.parse(args); err != nil {
+		return err
+	}
+	done := bot.startWorking(m.ChannelID, m.ID)
+	defer done()
+	found, err := bot.collectClips(m.ChannelID, m.ID, cargs)
+	if err != nil {
+		return err
+	}
+	if len(found) < 2 {
+		return errors.New("couldn't find enough clips")
+	}
+	var clips []vedit.Clip
+	// history is walked from newest to oldest, but the compilation
+	// should play in the order the clips were posted
+	for i := len(found) - 1; i >= 0; i-- {
+		if cargs.titles {
+			card, err := titleCard(found[i].author.DisplayOrUsername())
+			if err != nil {
+				return err
+			}
+			defer os.Remove(card)
+			clips = append(clips, vedit.Clip{
+				Name:  card,
+				Image: true,
+				End:   titleCardDuration,
+			})
+		}
+		clips = append(clips, mediaClip(found[i].media))
+	}
+	out, err := bot.createOutput(m.ID, "compilation", ".mp4")
+	if err != nil {
+		return err
+	}
+	opts := vedit.ConcatOptions{
+		Fit:    vedit.FitBlur,
+		Width:  compilationWidth,
+		Height: compilationHeight,
+	}
+	if !cargs.nonorm {
+		opts.Loudness = bot.loudnessTarget(m.GuildID)
+		if opts.Loudness == 0 {
+			opts.Loudness = defaultCompilationLoudness
+		}
+	}
+	if err = vedit.Concat(clips, opts, out.File.Name()); err != nil {
+		return err
+	}
+	done()
+	return out.Send(bot.Ctx.Client, m.ChannelID)
+}
+
+// collectClips walks the history of a channel from before the given message,
+// returning up to args.n clips matching args, newest first.
+func (bot *Bot) collectClips(ch discord.ChannelID, before discord.MessageID,
+	args compilationArguments) ([]compilationClip, error) {
+	var me discord.UserID
+	if args.nobot {
+		u, err := bot.Ctx.Me()
+		if err != nil {
+			return nil, err
+		}
+		me = u.ID
+	}
+	var oldest time.Time
+	if args.since > 0 {
+		oldest = time.Now().Add(-args.since)
+	}
+	var clips []compilationClip
+	for scanned := 0; scanned < maxCompilationScan; {
+		msgs, err := bot.Ctx.Client.MessagesBefore(ch, before, 100)
+		if err != nil {
+			return nil, err
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		for _, msg := range msgs {
+			if !oldest.IsZero() && msg.Timestamp.Time().Before(oldest) {
+				return clips, nil
+			}
+			if args.user.IsValid() && msg.Author.ID != args.user {
+				continue
+			}
+			if args.nobot && msg.Author.ID == me {
+				continue
+			}
+			media := bot.getMsgMedia(msg)
+			if media == nil || media.Type == mediaImage {
+				continue
+			}
+			clips = append(clips, compilationClip{media, msg.Author})
+			if len(clips) == args.n {
+				return clips, nil
+			}
+		}
+		scanned += len(msgs)
+		before = msgs[len(msgs)-1].ID
+	}
+	return clips, nil
+}
+
+// titleCard renders a title card with the given name to a temporary PNG file,
+// returning its path.
+func titleCard(name string) (string, error) {
+	f, err := os.CreateTemp("", "esammy.*.png")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	img := memegen.TitleCard(compilationWidth, compilationHeight,
+		strings.ToUpper(name))
+	if err = png.Encode(f, img); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/diamondburned/arikawa/v3/utils/bot"
@@ -23,9 +24,11 @@ import (
 type MemeArguments struct {
 	Top,
 	Bottom string
+	NoNorm bool
 }
 
 func (m *MemeArguments) CustomParse(args string) error {
+	args, m.NoNorm = cutNoNorm(args)
 	if args == "" {
 		return errors.New("you need some text for me to generate the image")
 	}
@@ -38,30 +41,68 @@ func (m *MemeArguments) CustomParse(args string) error {
 }
 
 func (bot *Bot) Meme(m *gateway.MessageCreateEvent, args MemeArguments) error {
-	return bot.composite(m.Message, "meme", func(w, h int) (image.Image, image.Point, bool) {
+	return bot.composite(m.Message, "meme", args.NoNorm, func(w, h int) (image.Image, image.Point, bool) {
 		m := image.NewRGBA(image.Rect(0, 0, w, h))
 		memegen.Impact(m, args.Top, args.Bottom)
 		return m, image.Point{}, false
 	})
 }
 
-func (bot *Bot) Motivate(m *gateway.MessageCreateEvent, args MemeArguments) error {
-	return bot.composite(m.Message, "motivate", func(w, h int) (image.Image, image.Point, bool) {
-		img, pt := memegen.Motivate(w, h, args.Top, args.Bottom)
+// maxMotivateTimes is how many posters an image can be framed in at once.
+const maxMotivateTimes = 5
+
+type MotivateArguments struct {
+	MemeArguments
+	Options memegen.MotivateOptions
+}
+
+// CustomParse parses options before the text, like "x3" to frame the image
+// in three posters or "border=red", as set by memegen.MotivateOptions.Set.
+// Anything after the options is parsed as for MemeArguments.
+func (m *MotivateArguments) CustomParse(args string) error {
+	args, nonorm := cutNoNorm(args)
+	for {
+		word, rest, _ := strings.Cut(args, " ")
+		if n, err := strconv.Atoi(strings.TrimPrefix(word, "x")); err == nil && word[0] == 'x' {
+			if n < 1 || n > maxMotivateTimes {
+				return fmt.Errorf("can only motivate between 1 and %d times", maxMotivateTimes)
+			}
+			m.Options.Times = n
+		} else if key, value, ok := strings.Cut(word, "="); !ok {
+			break
+		} else if err := m.Options.Set(key, value); errors.Is(err, memegen.ErrUnknownOption) {
+			// the text just starts with something like "a=b"
+			break
+		} else if err != nil {
+			return err
+		}
+		args = strings.TrimSpace(rest)
+	}
+	if err := m.MemeArguments.CustomParse(args); err != nil {
+		return err
+	}
+	m.NoNorm = m.NoNorm || nonorm
+	return nil
+}
+
+func (bot *Bot) Motivate(m *gateway.MessageCreateEvent, args MotivateArguments) error {
+	return bot.composite(m.Message, "motivate", args.NoNorm, func(w, h int) (image.Image, image.Point, bool) {
+		img, pt := memegen.Motivate(w, h, args.Top, args.Bottom, args.Options)
 		return img, pt, true
 	})
 }
 
 func (bot *Bot) Caption(m *gateway.MessageCreateEvent, raw bot.RawArguments) error {
-	return bot.composite(m.Message, "caption", func(w, h int) (image.Image, image.Point, bool) {
-		img, pt := memegen.Caption(w, h, string(raw))
+	text, nonorm := cutNoNorm(string(raw))
+	return bot.composite(m.Message, "caption", nonorm, func(w, h int) (image.Image, image.Point, bool) {
+		img, pt := memegen.Caption(w, h, text)
 		return img, pt, true
 	})
 }
 
 type compositeFunc func(int, int) (image.Image, image.Point, bool)
 
-func (bot *Bot) composite(m discord.Message, name string, imgfn compositeFunc) error {
+func (bot *Bot) composite(m discord.Message, name string, nonorm bool, imgfn compositeFunc) error {
 	media, err := bot.findMedia(m)
 	if err != nil {
 		return err
@@ -186,6 +227,11 @@ func (bot *Bot) composite(m discord.Message, name string, imgfn compositeFunc) e
 			}
 			return err
 		}
+		if format == "mp4" && !nonorm {
+			if err = bot.normalize(out, m.GuildID); err != nil {
+				return err
+			}
+		}
 		done()
 		return out.Send(bot.Ctx.Client, m.ChannelID)
 	}
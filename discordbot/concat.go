@@ -0,0 +1,119 @@
+package discordbot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"samhza.com/esammy/vedit"
+)
+
+type concatArguments struct {
+	clips  []string
+	ranges [][2]float64
+	opts   vedit.ConcatOptions
+	nonorm bool
+}
+
+// parse parses the arguments to Concat. Arguments are either options of the
+// form key=value, time ranges to trim clips to, or clip URLs and message
+// links. The time ranges apply to the clips in the order they are used, see
+// concatClips.
+func (c *concatArguments) parse(args []string) error {
+	for _, arg := range args {
+		if key, val, ok := strings.Cut(arg, "="); ok && !strings.Contains(key, "/") {
+			if err := c.parseOption(key, val); err != nil {
+				return err
+			}
+			continue
+		}
+		if arg == "nonorm" {
+			c.nonorm = true
+			continue
+		}
+		if start, end, err := vedit.ParseRange(arg); err == nil {
+			c.ranges = append(c.ranges, [2]float64{start, end})
+			continue
+		}
+		c.clips = append(c.clips, strings.Trim(arg, "<>"))
+	}
+	return nil
+}
+
+func (c *concatArguments) parseOption(key, val string) error {
+	var err error
+	switch key {
+	case "transition":
+		c.opts.Transition, err = vedit.ParseTransition(val)
+	case "duration":
+		c.opts.TransitionDuration, err = strconv.ParseFloat(val, 64)
+	case "fit":
+		c.opts.Fit, err = vedit.ParseFit(val)
+	case "length":
+		c.opts.ImageDuration, err = strconv.ParseFloat(val, 64)
+	default:
+		err = errors.New("unknown option")
+	}
+	if err != nil {
+		return fmt.Errorf("parsing option \"%s\": %w", key, err)
+	}
+	return nil
+}
+
+func (bot *Bot) Concat(m *gateway.MessageCreateEvent, args ...string) error {
+	var cargs concatArguments
+	if err := cargs.parse(args); err != nil {
+		return err
+	}
+	clips, err := bot.concatClips(m.Message, cargs.clips)
+	if err != nil {
+		return err
+	}
+	if len(clips) < 2 {
+		return errors.New("need at least 2 clips")
+	}
+	if len(cargs.ranges) > len(clips) {
+		return errors.New("more time ranges than clips")
+	}
+	for i, r := range cargs.ranges {
+		clips[i].Start, clips[i].End = r[0], r[1]
+	}
+	done := bot.startWorking(m.ChannelID, m.ID)
+	defer done()
+	out, err := bot.createOutput(m.ID, "combined", ".mp4")
+	if err != nil {
+		return err
+	}
+	err = vedit.Concat(clips, cargs.opts, out.File.Name())
+	if err != nil {
+		return err
+	}
+	if !cargs.nonorm {
+		if err = bot.normalize(out, m.GuildID); err != nil {
+			return err
+		}
+	}
+	done()
+	return out.Send(bot.Ctx.Client, m.ChannelID)
+}
+
+// concatClips collects the clips to concatenate, in the order described by
+// collectMedia.
+func (bot *Bot) concatClips(m discord.Message, args []string) ([]vedit.Clip, error) {
+	medias, err := bot.collectMedia(m, args)
+	if err != nil {
+		return nil, err
+	}
+	clips := make([]vedit.Clip, len(medias))
+	for i, media := range medias {
+		clips[i] = mediaClip(media)
+	}
+	return clips, nil
+}
+
+func mediaClip(media *Media) vedit.Clip {
+	return vedit.Clip{Name: media.URL, Image: media.Type == mediaImage}
+}
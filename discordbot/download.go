@@ -13,6 +13,7 @@ import (
 )
 
 func (b *Bot) Download(m *gateway.MessageCreateEvent, args bot.RawArguments) error {
+	url, nonorm := cutNoNorm(string(args))
 	done := b.startWorking(m.ChannelID, m.ID)
 	defer done()
 	dir, err := os.MkdirTemp("", "esammy")
@@ -27,7 +28,7 @@ func (b *Bot) Download(m *gateway.MessageCreateEvent, args bot.RawArguments) err
 		"--match-filter", "duration <=? 600 & !was_live & !is_live",
 		"--output", filepath.Join(dir, "%(title)s %(id)s.%(ext)s"),
 		"--",
-		string(args))
+		url)
 	stderr := strings.Builder{}
 	cmd.Stderr = &stderr
 	out, err := cmd.Output()
@@ -51,5 +52,10 @@ func (b *Bot) Download(m *gateway.MessageCreateEvent, args bot.RawArguments) err
 	of.name = basename[:len(basename)-len(ext)]
 	of.ext = ext
 	of.bot = b
+	if !nonorm {
+		if err = b.normalize(of, m.GuildID); err != nil {
+			return err
+		}
+	}
 	return of.Send(b.Ctx.Client, m.ChannelID)
 }
@@ -0,0 +1,91 @@
+package discordbot
+
+import (
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"samhza.com/esammy/memegen"
+)
+
+// maxCachedEmoji is how many emoji images are kept in memory before the
+// cache is emptied.
+const maxCachedEmoji = 1000
+
+// emojiRetry is how long emoji which couldn't be looked up are drawn as text
+// before they're looked up again.
+const emojiRetry = time.Minute
+
+// emojiSource is a memegen.EmojiSource which finds Unicode emoji in a
+// Twemoji-style directory, or among memegen's bundled emoji, and downloads
+// Discord custom emoji, keeping the images in memory.
+type emojiSource struct {
+	client *http.Client
+	// dir is where Unicode emoji are found
+	dir memegen.EmojiSource
+
+	mu    sync.Mutex
+	cache map[string]cachedEmoji
+}
+
+type cachedEmoji struct {
+	// img is nil for emoji without images
+	img image.Image
+	// failed is when looking the emoji up failed, or zero if it didn't
+	failed time.Time
+}
+
+func newEmojiSource(client *http.Client, dir string) *emojiSource {
+	e := &emojiSource{client: client, dir: memegen.BundledEmoji,
+		cache: make(map[string]cachedEmoji)}
+	if dir != "" {
+		e.dir = memegen.EmojiFS{FS: os.DirFS(dir)}
+	}
+	return e
+}
+
+func (e *emojiSource) EmojiImage(em memegen.Emoji) (image.Image, error) {
+	e.mu.Lock()
+	c, ok := e.cache[em.Text]
+	e.mu.Unlock()
+	if ok && (c.failed.IsZero() || time.Since(c.failed) < emojiRetry) {
+		return c.img, nil
+	}
+	img, err := e.find(em)
+	c = cachedEmoji{img: img}
+	if err != nil {
+		c.failed = time.Now()
+	}
+	e.mu.Lock()
+	if len(e.cache) >= maxCachedEmoji {
+		clear(e.cache)
+	}
+	e.cache[em.Text] = c
+	e.mu.Unlock()
+	return img, err
+}
+
+// find looks up the image of an emoji without the cache.
+func (e *emojiSource) find(em memegen.Emoji) (image.Image, error) {
+	if em.ID == "" {
+		return e.dir.EmojiImage(em)
+	}
+	// animated emoji are also served as PNGs of their first frame
+	resp, err := e.client.Get("https://cdn.discordapp.com/emojis/" + em.ID + ".png")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		img, _, err := image.Decode(resp.Body)
+		return img, err
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("downloading emoji: %s", resp.Status)
+	}
+}
@@ -0,0 +1,143 @@
+package discordbot
+
+import (
+	"errors"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/bot"
+	"samhza.com/esammy/imagefx"
+)
+
+// Fx applies a comma separated list of image effects, like "blur 2, invert",
+// to an image or GIF.
+func (bot *Bot) Fx(m *gateway.MessageCreateEvent, raw bot.RawArguments) error {
+	effect, err := imagefx.Parse(string(raw))
+	if err != nil {
+		return err
+	}
+	return bot.imageEffect(m, "fx", effect)
+}
+
+// Magik warps an image or GIF with seam carving. The strength, from 1 to 10,
+// defaults to 5.
+func (bot *Bot) Magik(m *gateway.MessageCreateEvent, args ...string) error {
+	strength := 5.0
+	switch len(args) {
+	case 0:
+	case 1:
+		var err error
+		strength, err = strconv.ParseFloat(args[0], 64)
+		if err != nil || strength < 1 || strength > 10 {
+			return errors.New("strength must be a number between 1 and 10")
+		}
+	default:
+		return errors.New("usage: magik [strength]")
+	}
+	return bot.imageEffect(m, "magik", imagefx.Magik(strength))
+}
+
+// Pixelsort sorts runs of pixels in an image, GIF or video. See
+// imagefx.Parse for its arguments.
+func (bot *Bot) Pixelsort(m *gateway.MessageCreateEvent, args ...string) error {
+	return bot.frameEffect(m, "pixelsort", "pixelsort "+strings.Join(args, " "))
+}
+
+// Dither dithers an image, GIF or video to a palette like "gameboy".
+func (bot *Bot) Dither(m *gateway.MessageCreateEvent, args ...string) error {
+	return bot.frameEffect(m, "dither", "dither "+strings.Join(args, " "))
+}
+
+// frameEffect applies an effect described by spec to an image or GIF, or to
+// each frame of a video by editing it with spec.
+func (bot *Bot) frameEffect(m *gateway.MessageCreateEvent, name, spec string) error {
+	if strings.Contains(spec, ",") {
+		return errors.New("only one effect can be applied at once")
+	}
+	media, err := bot.findMedia(m.Message)
+	if err != nil {
+		return err
+	}
+	if media.Type == mediaVideo || media.Type == mediaGIFV {
+		var args editArguments
+		if err = args.CustomParse(spec); err != nil {
+			return err
+		}
+		return bot.Edit(m, args)
+	}
+	effect, err := imagefx.Parse(spec)
+	if err != nil {
+		return err
+	}
+	return bot.imageEffect(m, name, effect)
+}
+
+func (bot *Bot) Invert(m *gateway.MessageCreateEvent) error {
+	return bot.imageEffect(m, "invert", imagefx.Invert())
+}
+
+func (bot *Bot) Grayscale(m *gateway.MessageCreateEvent) error {
+	return bot.imageEffect(m, "grayscale", imagefx.Grayscale())
+}
+
+func (bot *Bot) Crush(m *gateway.MessageCreateEvent) error {
+	return bot.imageEffect(m, "crush", imagefx.JPEGCrush(5))
+}
+
+func (bot *Bot) Swirl(m *gateway.MessageCreateEvent) error {
+	return bot.imageEffect(m, "swirl", imagefx.Swirl(3))
+}
+
+func (bot *Bot) Bulge(m *gateway.MessageCreateEvent) error {
+	return bot.imageEffect(m, "bulge", imagefx.Bulge(1))
+}
+
+// imageEffect applies an effect to the image or GIF found for the message,
+// without using ffmpeg.
+func (bot *Bot) imageEffect(m *gateway.MessageCreateEvent, name string,
+	effect imagefx.Effect) error {
+	media, err := bot.findMedia(m.Message)
+	if err != nil {
+		return err
+	}
+	if media.Type != mediaImage && media.Type != mediaGIF {
+		return errors.New("this only works on images and GIFs")
+	}
+	resp, err := bot.httpClient.Get(media.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	done := bot.startWorking(m.ChannelID, m.ID)
+	defer done()
+	r, w := io.Pipe()
+	defer r.Close()
+	ext := ".png"
+	if media.Type == mediaGIF {
+		g, err := gif.DecodeAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		g = imagefx.ApplyGIF(g, effect)
+		go func() {
+			w.CloseWithError(gif.EncodeAll(w, g))
+		}()
+		ext = ".gif"
+	} else {
+		img, _, err := image.Decode(resp.Body)
+		if err != nil {
+			return err
+		}
+		img = effect.Apply(img)
+		go func() {
+			w.CloseWithError(png.Encode(w, img))
+		}()
+	}
+	done()
+	return bot.sendFile(m.ChannelID, m.ID, name, ext, r)
+}
@@ -0,0 +1,66 @@
+package discordbot
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"samhza.com/esammy/vedit"
+)
+
+// GuildConfig holds settings which can be overridden per guild.
+type GuildConfig struct {
+	// Loudness is the target loudness of outputs in LUFS. Zero disables
+	// loudness normalization.
+	Loudness *float64 `toml:"loudness"`
+}
+
+func (b *Bot) loudnessTarget(guild discord.GuildID) float64 {
+	if gcfg, ok := b.cfg.Guilds[guild.String()]; ok && gcfg.Loudness != nil {
+		return *gcfg.Loudness
+	}
+	return b.cfg.Loudness
+}
+
+// normalize normalizes the loudness of an output file if loudness
+// normalization is enabled for the guild, replacing out.File with the
+// normalized file.
+func (b *Bot) normalize(out *outputFile, guild discord.GuildID) error {
+	target := b.loudnessTarget(guild)
+	if target == 0 {
+		return nil
+	}
+	f, err := os.CreateTemp(b.cfg.OutputDir, "*"+out.ext)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	err = vedit.Normalize(out.File.Name(), f.Name(), target)
+	if err != nil {
+		os.Remove(f.Name())
+		if errors.Is(err, vedit.ErrNoAudio) {
+			return nil
+		}
+		return err
+	}
+	f, err = os.Open(f.Name())
+	if err != nil {
+		return err
+	}
+	out.File.Close()
+	os.Remove(out.File.Name())
+	out.File = f
+	return nil
+}
+
+// cutNoNorm removes a leading "nonorm" argument from args, reporting whether
+// it was present.
+func cutNoNorm(args string) (rest string, nonorm bool) {
+	args = strings.TrimSpace(args)
+	word, rest, _ := strings.Cut(args, " ")
+	if word != "nonorm" {
+		return args, false
+	}
+	return strings.TrimSpace(rest), true
+}
@@ -1,9 +1,11 @@
 package discordbot
 
 import (
+	"fmt"
 	"mime"
 	"net/url"
 	"path"
+	"regexp"
 	"strings"
 
 	"github.com/diamondburned/arikawa/v3/discord"
@@ -32,6 +34,15 @@ func (b *Bot) findMedia(m discord.Message) (*Media, error) {
 	if media != nil {
 		return media, nil
 	}
+	for _, link := range messageLinkRe.FindAllString(m.Content, -1) {
+		media, err := b.linkedMedia(m, link)
+		if err != nil {
+			return nil, err
+		}
+		if media != nil {
+			return media, nil
+		}
+	}
 	if m.Type == discord.InlinedReplyMessage && m.ReferencedMessage != nil {
 		media = b.getMsgMedia(*m.ReferencedMessage)
 		if media != nil {
@@ -51,6 +62,111 @@ func (b *Bot) findMedia(m discord.Message) (*Media, error) {
 	return nil, errors.New("no media found")
 }
 
+var messageLinkRe = regexp.MustCompile(
+	`https://(?:(?:canary|ptb)\.)?discord(?:app)?\.com/channels/(\d+|@me)/(\d+)/(\d+)`)
+
+// linkedMedia returns the media in the message linked to by link in m. It
+// returns nil if the message has no media, and an error if link isn't a
+// message link. Links are only followed to messages in the same guild as m,
+// in channels the author of m can read, so that nobody can use the bot to
+// get at media they couldn't see themselves.
+func (b *Bot) linkedMedia(m discord.Message, link string) (*Media, error) {
+	match := messageLinkRe.FindStringSubmatch(link)
+	if match == nil {
+		return nil, errors.New("not a message link")
+	}
+	ch, err := discord.ParseSnowflake(match[2])
+	if err != nil {
+		return nil, err
+	}
+	id, err := discord.ParseSnowflake(match[3])
+	if err != nil {
+		return nil, err
+	}
+	chID := discord.ChannelID(ch)
+	if err = b.checkLinkedChannel(m, match[1], chID); err != nil {
+		return nil, err
+	}
+	msg, err := b.Ctx.Client.Message(chID, discord.MessageID(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching linked message")
+	}
+	return b.getMsgMedia(*msg), nil
+}
+
+// checkLinkedChannel returns an error unless the author of m can read the
+// channel ch, linked to as being in guild, which is "@me" for direct
+// messages.
+func (b *Bot) checkLinkedChannel(m discord.Message, guild string, ch discord.ChannelID) error {
+	if guild == "@me" {
+		// direct messages can only be linked to from the same conversation
+		if m.GuildID.IsValid() || ch != m.ChannelID {
+			return errors.New("linked message is in another conversation")
+		}
+		return nil
+	}
+	if guild != m.GuildID.String() {
+		return errors.New("linked message is in another server")
+	}
+	c, err := b.Ctx.Channel(ch)
+	if err != nil {
+		return errors.Wrap(err, "fetching linked channel")
+	}
+	if c.GuildID != m.GuildID {
+		return errors.New("linked message is in another server")
+	}
+	perms, err := b.Ctx.Permissions(ch, m.Author.ID)
+	if err != nil {
+		return errors.Wrap(err, "checking permissions in linked channel")
+	}
+	if !perms.Has(discord.PermissionViewChannel | discord.PermissionReadMessageHistory) {
+		return errors.New("you can't read the linked channel")
+	}
+	return nil
+}
+
+// collectMedia collects every piece of media a command was given: first the
+// media of the message being replied to, then the URLs and message links in
+// args, then the message's attachments.
+func (b *Bot) collectMedia(m discord.Message, args []string) ([]*Media, error) {
+	var medias []*Media
+	if m.Type == discord.InlinedReplyMessage && m.ReferencedMessage != nil {
+		if media := b.getMsgMedia(*m.ReferencedMessage); media != nil {
+			medias = append(medias, media)
+		}
+	}
+	for _, arg := range args {
+		arg = strings.Trim(arg, "<>")
+		if !messageLinkRe.MatchString(arg) {
+			// anything else would be opened by ffmpeg as it is, which
+			// could be a file on this machine or one of its protocols
+			u, err := url.Parse(arg)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("%q isn't a link", arg)
+			}
+			medias = append(medias, &Media{URL: arg, Type: guessMediaType(path.Ext(u.Path))})
+			continue
+		}
+		media, err := b.linkedMedia(m, arg)
+		if err != nil {
+			return nil, err
+		}
+		if media == nil {
+			return nil, errors.New("linked message has no media")
+		}
+		medias = append(medias, media)
+	}
+	for _, at := range m.Attachments {
+		medias = append(medias, &Media{
+			URL:    at.Proxy,
+			Height: int(at.Height),
+			Width:  int(at.Width),
+			Type:   guessMediaType(path.Ext(at.Filename)),
+		})
+	}
+	return medias, nil
+}
+
 func (b *Bot) getMsgMedia(m discord.Message) *Media {
 	for _, at := range m.Attachments {
 		if at.Height == 0 {
@@ -117,6 +233,17 @@ func mediaTypeByExt(ext string) mediaType {
 	return mediaImage
 }
 
+// guessMediaType is like mediaTypeByExt, but assumes media with an unknown
+// extension is a video, as it's used for URLs which may point to anything
+// ffmpeg can read.
+func guessMediaType(ext string) mediaType {
+	mime := mime.TypeByExtension(ext)
+	if !strings.HasPrefix(mime, "image/") {
+		return mediaVideo
+	}
+	return mediaTypeByExt(ext)
+}
+
 func (b *Bot) gifURL(gifvURL string) string {
 	switch {
 	case strings.HasPrefix(gifvURL, "https://tenor.com") && b.tenor != nil:
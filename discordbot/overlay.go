@@ -0,0 +1,147 @@
+package discordbot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/disintegration/imaging"
+	"samhza.com/esammy/vedit"
+)
+
+// Overlay puts one piece of media on top of another. The base is the media
+// being replied to and the overlay is the attachment or link. Arguments are
+// a position like "topleft", "scale=0.5" to set the overlay's width relative
+// to the base, and "key" or "key=<colour>" to key out a green screen.
+func (bot *Bot) Overlay(m *gateway.MessageCreateEvent, args ...string) error {
+	opts := vedit.OverlayOptions{Scale: 0.3}
+	var nonorm, scaled bool
+	var mediaArgs []string
+	for _, arg := range args {
+		key, val, hasVal := strings.Cut(arg, "=")
+		if pos, ok := vedit.ParsePosition(arg); ok {
+			opts.Position = pos
+			continue
+		}
+		var err error
+		switch {
+		case key == "scale" && hasVal:
+			opts.Scale, err = strconv.ParseFloat(val, 64)
+			if err == nil && (opts.Scale <= 0 || opts.Scale > 1) {
+				err = errors.New("scale must be between 0 and 1")
+			}
+			scaled = true
+		case key == "key" || key == "greenscreen":
+			opts.KeyColor, err = vedit.ParseKeyColor(val)
+		case key == "similarity" && hasVal:
+			opts.Similarity, err = strconv.ParseFloat(val, 64)
+		case arg == "nonorm":
+			nonorm = true
+		default:
+			mediaArgs = append(mediaArgs, arg)
+		}
+		if err != nil {
+			return fmt.Errorf("parsing \"%s\": %w", key, err)
+		}
+	}
+	// green screen templates usually cover the whole base
+	if opts.KeyColor != "" && !scaled {
+		opts.Scale = 1
+		opts.Position = vedit.PositionCenter
+	}
+	medias, err := bot.collectMedia(m.Message, mediaArgs)
+	if err != nil {
+		return err
+	}
+	if len(medias) < 2 {
+		return errors.New("reply to the media to put the overlay on, and attach or link the overlay")
+	}
+	base, ov := medias[0], medias[1]
+	done := bot.startWorking(m.ChannelID, m.ID)
+	defer done()
+
+	if base.Type == mediaImage && ov.Type == mediaImage {
+		baseImg, err := bot.downloadImage(base.URL)
+		if err != nil {
+			return err
+		}
+		ovImg, err := bot.downloadImage(ov.URL)
+		if err != nil {
+			return err
+		}
+		r, w := io.Pipe()
+		defer r.Close()
+		go func() {
+			w.CloseWithError(png.Encode(w, overlayImage(baseImg, ovImg, opts)))
+		}()
+		done()
+		return bot.sendFile(m.ChannelID, m.ID, "overlay", ".png", r)
+	}
+
+	// the output is a video if either input is, otherwise a GIF
+	format := "gif"
+	if base.Type == mediaVideo || ov.Type == mediaVideo {
+		format = "mp4"
+	}
+	out, err := bot.createOutput(m.ID, "overlay", "."+format)
+	if err != nil {
+		return err
+	}
+	err = vedit.Overlay(
+		vedit.OverlayInput{Name: base.URL, Image: base.Type == mediaImage},
+		vedit.OverlayInput{Name: ov.URL, Image: ov.Type == mediaImage},
+		opts, out.File.Name(), format)
+	if err != nil {
+		return err
+	}
+	if format == "mp4" && !nonorm {
+		if err = bot.normalize(out, m.GuildID); err != nil {
+			return err
+		}
+	}
+	done()
+	return out.Send(bot.Ctx.Client, m.ChannelID)
+}
+
+// overlayImage draws ov on top of base like vedit.Overlay does.
+func overlayImage(base, ov image.Image, opts vedit.OverlayOptions) image.Image {
+	dst := imaging.Clone(base)
+	r := vedit.OverlayRect(dst.Bounds().Size(), ov.Bounds().Size(), opts)
+	scaled := imaging.Resize(ov, r.Dx(), r.Dy(), imaging.Lanczos)
+	if opts.KeyColor != "" {
+		similarity := opts.Similarity
+		if similarity == 0 {
+			similarity = vedit.DefaultSimilarity
+		}
+		colorKey(scaled, opts.KeyColor, similarity)
+	}
+	draw.Draw(dst, r, scaled, image.Point{}, draw.Over)
+	return dst
+}
+
+// colorKey makes the pixels of img within similarity of the hex colour key
+// transparent. Like ffmpeg's colorkey filter, similarity is the distance
+// between colours in RGB space normalized to be between 0 and 1.
+func colorKey(img *image.NRGBA, key string, similarity float64) {
+	k, _ := strconv.ParseUint(key, 16, 32)
+	kr, kg, kb := float64(k>>16&0xff), float64(k>>8&0xff), float64(k&0xff)
+	max := math.Sqrt(3 * 255 * 255)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+			dr, dg, db := float64(c.R)-kr, float64(c.G)-kg, float64(c.B)-kb
+			if math.Sqrt(dr*dr+dg*dg+db*db)/max < similarity {
+				img.SetNRGBA(x, y, color.NRGBA{})
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package discordbot
+
+import (
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/disintegration/imaging"
+	"samhza.com/esammy/vedit"
+)
+
+// Reframe changes the aspect ratio of media to one like 9:16, filling the
+// space around it with a blurred copy of itself.
+func (bot *Bot) Reframe(m *gateway.MessageCreateEvent, ratio string) error {
+	aspect, err := vedit.ParseAspect(ratio)
+	if err != nil {
+		return err
+	}
+	media, err := bot.findMedia(m.Message)
+	if err != nil {
+		return err
+	}
+	done := bot.startWorking(m.ChannelID, m.ID)
+	defer done()
+	if media.Type == mediaImage {
+		img, err := bot.downloadImage(media.URL)
+		if err != nil {
+			return err
+		}
+		r, w := io.Pipe()
+		defer r.Close()
+		go func() {
+			w.CloseWithError(png.Encode(w, reframeImage(img, aspect)))
+		}()
+		done()
+		return bot.sendFile(m.ChannelID, m.ID, "reframe", ".png", r)
+	}
+	format := "gif"
+	if media.Type == mediaVideo {
+		format = "mp4"
+	}
+	out, err := bot.createOutput(m.ID, "reframe", "."+format)
+	if err != nil {
+		return err
+	}
+	if err = vedit.Reframe(media.URL, aspect, out.File.Name(), format); err != nil {
+		return err
+	}
+	done()
+	return out.Send(bot.Ctx.Client, m.ChannelID)
+}
+
+// reframeImage reframes an image the same way vedit.Reframe does videos.
+func reframeImage(img image.Image, aspect vedit.Aspect) image.Image {
+	size := img.Bounds().Size()
+	w, h := vedit.ReframeSize(size.X, size.Y, aspect)
+	dst := imaging.Fill(img, w, h, imaging.Center, imaging.Linear)
+	dst = imaging.Blur(dst, math.Min(float64(w), float64(h))/40)
+	fg := imaging.Fit(img, w, h, imaging.Linear)
+	fsize := fg.Bounds().Size()
+	pt := image.Pt(w-fsize.X, h-fsize.Y).Div(2)
+	draw.Draw(dst, image.Rectangle{pt, pt.Add(fsize)}, fg, image.Point{}, draw.Over)
+	return dst
+}
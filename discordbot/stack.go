@@ -0,0 +1,186 @@
+package discordbot
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/disintegration/imaging"
+	"samhza.com/esammy/vedit"
+)
+
+func (bot *Bot) Hstack(m *gateway.MessageCreateEvent, args ...string) error {
+	return bot.stack(m, "hstack", vedit.LayoutHorizontal, args)
+}
+
+func (bot *Bot) Vstack(m *gateway.MessageCreateEvent, args ...string) error {
+	return bot.stack(m, "vstack", vedit.LayoutVertical, args)
+}
+
+func (bot *Bot) Grid(m *gateway.MessageCreateEvent, args ...string) error {
+	return bot.stack(m, "grid", vedit.LayoutGrid, args)
+}
+
+// maxStackInputs is the most media that can be stacked at once.
+const maxStackInputs = 16
+
+func (bot *Bot) stack(m *gateway.MessageCreateEvent, name string,
+	layout vedit.Layout, args []string) error {
+	opts := vedit.StackOptions{Layout: layout}
+	var nonorm bool
+	var mediaArgs []string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "audio="):
+			var err error
+			opts.Audio, err = parseAudioInputs(strings.TrimPrefix(arg, "audio="))
+			if err != nil {
+				return err
+			}
+		case arg == "nonorm":
+			nonorm = true
+		default:
+			mediaArgs = append(mediaArgs, arg)
+		}
+	}
+	medias, err := bot.collectMedia(m.Message, mediaArgs)
+	if err != nil {
+		return err
+	}
+	if len(medias) < 2 {
+		return errors.New("need at least 2 things to stack")
+	}
+	if len(medias) > maxStackInputs {
+		return fmt.Errorf("can't stack more than %d things", maxStackInputs)
+	}
+	done := bot.startWorking(m.ChannelID, m.ID)
+	defer done()
+
+	allImages, anyVideo := true, false
+	inputs := make([]vedit.StackInput, len(medias))
+	for i, media := range medias {
+		inputs[i] = vedit.StackInput{Name: media.URL, Image: media.Type == mediaImage}
+		allImages = allImages && media.Type == mediaImage
+		anyVideo = anyVideo || media.Type == mediaVideo
+	}
+	if allImages {
+		imgs := make([]image.Image, len(medias))
+		for i, media := range medias {
+			imgs[i], err = bot.downloadImage(media.URL)
+			if err != nil {
+				return err
+			}
+		}
+		r, w := io.Pipe()
+		defer r.Close()
+		go func() {
+			w.CloseWithError(png.Encode(w, stackImages(imgs, layout)))
+		}()
+		done()
+		return bot.sendFile(m.ChannelID, m.ID, name, ".png", r)
+	}
+
+	ext := ".gif"
+	if anyVideo {
+		ext = ".mp4"
+	} else {
+		opts.GIF = true
+	}
+	out, err := bot.createOutput(m.ID, name, ext)
+	if err != nil {
+		return err
+	}
+	if err = vedit.Stack(inputs, opts, out.File.Name()); err != nil {
+		return err
+	}
+	if anyVideo && !nonorm {
+		if err = bot.normalize(out, m.GuildID); err != nil {
+			return err
+		}
+	}
+	done()
+	return out.Send(bot.Ctx.Client, m.ChannelID)
+}
+
+// parseAudioInputs parses a comma separated list of the 1-based numbers of
+// the inputs whose audio should be used. "all" uses every input's audio and
+// "none" uses none.
+func parseAudioInputs(s string) ([]int, error) {
+	switch s {
+	case "all":
+		return nil, nil
+	case "none":
+		return []int{}, nil
+	}
+	var inputs []int
+	for _, n := range strings.Split(s, ",") {
+		i, err := strconv.Atoi(n)
+		if err != nil || i < 1 {
+			return nil, fmt.Errorf("invalid audio input %q", n)
+		}
+		inputs = append(inputs, i-1)
+	}
+	return inputs, nil
+}
+
+func (bot *Bot) downloadImage(url string) (image.Image, error) {
+	resp, err := bot.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	img, _, err := image.Decode(resp.Body)
+	return img, err
+}
+
+// stackImages combines images the same way vedit.Stack combines videos.
+func stackImages(imgs []image.Image, layout vedit.Layout) image.Image {
+	first := imgs[0].Bounds().Size()
+	var dst *image.NRGBA
+	switch layout {
+	case vedit.LayoutHorizontal:
+		var w int
+		for i, img := range imgs {
+			imgs[i] = imaging.Resize(img, 0, first.Y, imaging.Lanczos)
+			w += imgs[i].Bounds().Dx()
+		}
+		dst = imaging.New(w, first.Y, image.Black)
+		var x int
+		for _, img := range imgs {
+			draw.Draw(dst, img.Bounds().Add(image.Pt(x, 0)), img,
+				img.Bounds().Min, draw.Src)
+			x += img.Bounds().Dx()
+		}
+	case vedit.LayoutVertical:
+		var h int
+		for i, img := range imgs {
+			imgs[i] = imaging.Resize(img, first.X, 0, imaging.Lanczos)
+			h += imgs[i].Bounds().Dy()
+		}
+		dst = imaging.New(first.X, h, image.Black)
+		var y int
+		for _, img := range imgs {
+			draw.Draw(dst, img.Bounds().Add(image.Pt(0, y)), img,
+				img.Bounds().Min, draw.Src)
+			y += img.Bounds().Dy()
+		}
+	case vedit.LayoutGrid:
+		cols, rows := vedit.GridSize(len(imgs))
+		dst = imaging.New(first.X*cols, first.Y*rows, image.Black)
+		for i, img := range imgs {
+			img = imaging.Fit(img, first.X, first.Y, imaging.Lanczos)
+			size := img.Bounds().Size()
+			cell := image.Pt((i%cols)*first.X, (i/cols)*first.Y)
+			pt := cell.Add(first.Sub(size).Div(2))
+			draw.Draw(dst, image.Rectangle{pt, pt.Add(size)}, img,
+				img.Bounds().Min, draw.Src)
+		}
+	}
+	return dst
+}
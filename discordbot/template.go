@@ -0,0 +1,87 @@
+package discordbot
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"io"
+	"sort"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/sendpart"
+	"github.com/disintegration/imaging"
+)
+
+// Template renders a meme template with the given texts, like
+// `template drake "a" "b"`.
+func (bot *Bot) Template(m *gateway.MessageCreateEvent, name string, texts ...string) error {
+	t, ok := bot.templates[name]
+	if !ok {
+		return fmt.Errorf("there is no template called %q", name)
+	}
+	img, err := t.Render(texts)
+	if err != nil {
+		return err
+	}
+	r, w := io.Pipe()
+	defer r.Close()
+	go func() {
+		w.CloseWithError(png.Encode(w, img))
+	}()
+	return bot.sendFile(m.ChannelID, m.ID, name, ".png", r)
+}
+
+// galleryPageSize is how many templates are shown per message by Templates,
+// which is the most embeds a message can have.
+const galleryPageSize = 10
+
+// galleryThumbSize is the size of the thumbnails of templates shown by
+// Templates.
+const galleryThumbSize = 160
+
+// Templates lists the available meme templates.
+func (bot *Bot) Templates(m *gateway.MessageCreateEvent) error {
+	if len(bot.templates) == 0 {
+		_, err := bot.Ctx.SendTextReply(m.ChannelID, "There are no templates.", m.ID)
+		return err
+	}
+	names := make([]string, 0, len(bot.templates))
+	for name := range bot.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for len(names) > 0 {
+		page := names[:min(len(names), galleryPageSize)]
+		names = names[len(page):]
+		var data api.SendMessageData
+		data.Reference = &discord.MessageReference{MessageID: m.ID}
+		for _, name := range page {
+			t := bot.templates[name]
+			thumb := new(bytes.Buffer)
+			err := png.Encode(thumb, imaging.Fit(t.Image,
+				galleryThumbSize, galleryThumbSize, imaging.Linear))
+			if err != nil {
+				return err
+			}
+			desc := fmt.Sprintf("%d text boxes", len(t.Boxes))
+			if t.Description != "" {
+				desc = t.Description + "\n" + desc
+			}
+			data.Embeds = append(data.Embeds, discord.Embed{
+				Title:       name,
+				Description: desc,
+				Thumbnail: &discord.EmbedThumbnail{
+					URL: "attachment://" + name + ".png",
+				},
+			})
+			data.Files = append(data.Files,
+				sendpart.File{Name: name + ".png", Reader: thumb})
+		}
+		if _, err := bot.Ctx.SendMessageComplex(m.ChannelID, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -16,8 +16,8 @@ require (
 	github.com/pelletier/go-toml v1.9.5
 	github.com/pkg/errors v0.9.1
 	golang.org/x/image v0.15.0
+	golang.org/x/text v0.14.0
 	samhza.com/ffmpeg v0.0.0-20220104160918-b1bc70395af8
-	samhza.com/gg v1.3.1
 	samhza.com/ytsearch v0.0.0-20220104160835-a0930e67ff04
 )
 
@@ -42,7 +42,6 @@ require (
 	golang.org/x/crypto v0.17.0 // indirect
 	golang.org/x/net v0.19.0 // indirect
 	golang.org/x/sys v0.16.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
 	golang.org/x/time v0.5.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 )
@@ -0,0 +1,91 @@
+package imagefx
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Swirl twists images around their centre. strength is the angle in radians
+// the centre is turned by, fading out to no turn at the edge of the largest
+// circle that fits in the image.
+func Swirl(strength float64) Effect {
+	return distortion(func(r, theta, radius float64) (float64, float64) {
+		t := 1 - r/radius
+		return r, theta + strength*t*t
+	})
+}
+
+// Bulge magnifies the centre of images, as if they were stretched over a
+// ball. Negative strengths pinch the centre instead.
+func Bulge(strength float64) Effect {
+	return distortion(func(r, theta, radius float64) (float64, float64) {
+		return radius * math.Pow(r/radius, 1+strength), theta
+	})
+}
+
+// distortion returns an Effect which moves pixels within the largest circle
+// that fits in the image. For each pixel of the output, at polar coordinates
+// (r, theta) relative to the centre, fn gives the coordinates of the input
+// pixel to sample.
+func distortion(fn func(r, theta, radius float64) (float64, float64)) Effect {
+	return Func(func(img image.Image) image.Image {
+		src := imaging.Clone(img)
+		b := src.Bounds()
+		dst := imaging.Clone(src)
+		cx, cy := float64(b.Dx())/2, float64(b.Dy())/2
+		radius := math.Min(cx, cy)
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+				r := math.Hypot(dx, dy)
+				if r >= radius {
+					continue
+				}
+				sr, st := fn(r, math.Atan2(dy, dx), radius)
+				sx := cx + sr*math.Cos(st) - 0.5
+				sy := cy + sr*math.Sin(st) - 0.5
+				dst.SetNRGBA(x, y, bilinear(src, sx, sy))
+			}
+		}
+		return dst
+	})
+}
+
+// bilinear samples img at a point between pixels. img must have its bounds
+// start at the origin.
+func bilinear(img *image.NRGBA, x, y float64) color.NRGBA {
+	b := img.Bounds()
+	clamp := func(v, max int) int {
+		if v < 0 {
+			return 0
+		}
+		if v >= max {
+			return max - 1
+		}
+		return v
+	}
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	var c [4]float64
+	for _, p := range [4]struct {
+		x, y int
+		w    float64
+	}{
+		{x0, y0, (1 - fx) * (1 - fy)},
+		{x0 + 1, y0, fx * (1 - fy)},
+		{x0, y0 + 1, (1 - fx) * fy},
+		{x0 + 1, y0 + 1, fx * fy},
+	} {
+		px := img.NRGBAAt(clamp(p.x, b.Dx()), clamp(p.y, b.Dy()))
+		c[0] += float64(px.R) * p.w
+		c[1] += float64(px.G) * p.w
+		c[2] += float64(px.B) * p.w
+		c[3] += float64(px.A) * p.w
+	}
+	return color.NRGBA{
+		uint8(c[0] + 0.5), uint8(c[1] + 0.5), uint8(c[2] + 0.5), uint8(c[3] + 0.5),
+	}
+}
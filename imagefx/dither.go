@@ -0,0 +1,90 @@
+package imagefx
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+func rgb(hex uint32) color.Color {
+	return color.NRGBA{uint8(hex >> 16), uint8(hex >> 8), uint8(hex), 0xff}
+}
+
+// Palettes are the palettes which can be given to Dither by name.
+var Palettes = map[string]color.Palette{
+	"1bit":    {rgb(0x000000), rgb(0xffffff)},
+	"gameboy": {rgb(0x0f380f), rgb(0x306230), rgb(0x8bac0f), rgb(0x9bbc0f)},
+	"cga":     {rgb(0x000000), rgb(0x55ffff), rgb(0xff55ff), rgb(0xffffff)},
+	"pico8": {
+		rgb(0x000000), rgb(0x1d2b53), rgb(0x7e2553), rgb(0x008751),
+		rgb(0xab5236), rgb(0x5f574f), rgb(0xc2c3c7), rgb(0xfff1e8),
+		rgb(0xff004d), rgb(0xffa300), rgb(0xffec27), rgb(0x00e436),
+		rgb(0x29adff), rgb(0x83769c), rgb(0xff77a8), rgb(0xffccaa),
+	},
+	"websafe": palette.WebSafe,
+	"plan9":   palette.Plan9,
+}
+
+// PaletteNames returns the names of Palettes in alphabetical order.
+func PaletteNames() []string {
+	names := make([]string, 0, len(Palettes))
+	for name := range Palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DitherMethod is how Dither spreads the error of approximating colours.
+type DitherMethod int
+
+const (
+	// DitherFloydSteinberg diffuses the error onto neighbouring pixels.
+	DitherFloydSteinberg DitherMethod = iota
+	// DitherOrdered offsets pixels by a repeating Bayer matrix, giving a
+	// crosshatched look.
+	DitherOrdered
+)
+
+// bayer is a 4x4 Bayer matrix.
+var bayer = [4][4]float64{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// Dither reduces images to the colours of pal. Transparent pixels are kept
+// transparent if pal has fewer than 256 colours. The resulting images are
+// *image.Paletted.
+func Dither(pal color.Palette, method DitherMethod) Effect {
+	pal = withTransparent(pal)
+	// spread is how far the ordered dither may move a channel, which should
+	// be about the distance between colours of the palette
+	spread := 255 / math.Cbrt(float64(len(pal)))
+	return Func(func(img image.Image) image.Image {
+		b := img.Bounds()
+		dst := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), pal)
+		if method == DitherFloydSteinberg {
+			draw.FloydSteinberg.Draw(dst, dst.Rect, img, b.Min)
+			return dst
+		}
+		offset := func(v uint8, t float64) uint8 {
+			return uint8(math.Min(math.Max(float64(v)+t*spread, 0), 255))
+		}
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+				if c.A != 0 {
+					t := (bayer[y%4][x%4]+0.5)/16 - 0.5
+					c = color.NRGBA{offset(c.R, t), offset(c.G, t), offset(c.B, t), 0xff}
+				}
+				dst.SetColorIndex(x, y, uint8(pal.Index(c)))
+			}
+		}
+		return dst
+	})
+}
@@ -0,0 +1,148 @@
+package imagefx
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+
+	"github.com/disintegration/imaging"
+)
+
+// colorOnly reports whether e only changes pixels independently of each
+// other, returning a function applying it to a single colour if so.
+func colorOnly(e Effect) (func(color.Color) color.Color, bool) {
+	switch e := e.(type) {
+	case ColorEffect:
+		return e.MapColor, true
+	case Chain:
+		fns := make([]func(color.Color) color.Color, len(e))
+		for i, e := range e {
+			var ok bool
+			if fns[i], ok = colorOnly(e); !ok {
+				return nil, false
+			}
+		}
+		return func(c color.Color) color.Color {
+			for _, fn := range fns {
+				c = fn(c)
+			}
+			return c
+		}, true
+	}
+	return nil, false
+}
+
+// ApplyGIF applies an effect to every frame of a GIF, keeping its frame
+// delays, disposal methods and loop count.
+//
+// Effects which only change colours are applied to the palettes of the GIF.
+// Other effects are applied to each frame after compositing it onto the
+// frames before it, so the resulting frames always cover the whole image.
+// A FramesEffect is given all of the composited frames at once. Frames
+// resulting as *image.Paletted are used as they are, and the rest share a
+// palette chosen from their colours.
+func ApplyGIF(g *gif.GIF, e Effect) *gif.GIF {
+	out := &gif.GIF{
+		Delay:           append([]int(nil), g.Delay...),
+		Disposal:        append([]byte(nil), g.Disposal...),
+		LoopCount:       g.LoopCount,
+		BackgroundIndex: g.BackgroundIndex,
+	}
+	if len(g.Image) == 0 {
+		return out
+	}
+	if fn, ok := colorOnly(e); ok {
+		out.Config = g.Config
+		if pal, ok := g.Config.ColorModel.(color.Palette); ok {
+			out.Config.ColorModel = mapPalette(pal, fn)
+		}
+		for _, frame := range g.Image {
+			out.Image = append(out.Image, &image.Paletted{
+				Pix:     frame.Pix,
+				Stride:  frame.Stride,
+				Rect:    frame.Rect,
+				Palette: mapPalette(frame.Palette, fn),
+			})
+		}
+		return out
+	}
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		for _, frame := range g.Image {
+			bounds = bounds.Union(frame.Rect)
+		}
+	}
+	canvas := image.NewNRGBA(bounds)
+	var saved *image.NRGBA
+	frames := make([]image.Image, len(g.Image))
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			saved = image.NewNRGBA(bounds)
+			copy(saved.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Rect, frame, frame.Rect.Min, draw.Over)
+		frames[i] = imaging.Clone(canvas)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Rect, image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = saved
+		}
+	}
+	results := applyFrames(e, frames)
+	// the effect can change the colours of the frames as well as moving
+	// them around, so they're given a palette of the colours they end up
+	// with, except where effects like Dither chose the palette themselves
+	var unpaletted []image.Image
+	for _, res := range results {
+		if _, ok := res.(*image.Paletted); !ok {
+			unpaletted = append(unpaletted, res)
+		}
+	}
+	var pal color.Palette
+	if len(unpaletted) > 0 {
+		pal = quantize(unpaletted)
+	}
+	for _, res := range results {
+		if p, ok := res.(*image.Paletted); ok {
+			out.Image = append(out.Image, p)
+			continue
+		}
+		p := image.NewPaletted(res.Bounds(), pal)
+		draw.FloydSteinberg.Draw(p, p.Rect, res, res.Bounds().Min)
+		out.Image = append(out.Image, p)
+	}
+	out.Config.Width = out.Image[0].Rect.Dx()
+	out.Config.Height = out.Image[0].Rect.Dy()
+	return out
+}
+
+func mapPalette(pal color.Palette, fn func(color.Color) color.Color) color.Palette {
+	mapped := make(color.Palette, len(pal))
+	for i, c := range pal {
+		mapped[i] = fn(c)
+	}
+	return mapped
+}
+
+// withTransparent returns pal with a transparent colour added if it doesn't
+// have one and there's room for it, as effects like rotation can make parts
+// of frames transparent.
+func withTransparent(pal color.Palette) color.Palette {
+	for _, c := range pal {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return pal
+		}
+	}
+	if len(pal) >= 256 {
+		return pal
+	}
+	return append(pal[:len(pal):len(pal)], color.Transparent)
+}
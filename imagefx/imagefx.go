@@ -0,0 +1,348 @@
+// Package imagefx implements effects for still images and GIFs in pure Go.
+package imagefx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Effect transforms an image.
+type Effect interface {
+	Apply(image.Image) image.Image
+}
+
+// ColorEffect is an Effect which changes each pixel independently of the
+// others. Applying it to a GIF only needs its palettes to be changed.
+type ColorEffect func(color.NRGBA) color.NRGBA
+
+func (f ColorEffect) Apply(img image.Image) image.Image {
+	return imaging.AdjustFunc(img, f)
+}
+
+// MapColor applies the effect to a single colour.
+func (f ColorEffect) MapColor(c color.Color) color.Color {
+	return f(color.NRGBAModel.Convert(c).(color.NRGBA))
+}
+
+// FramesEffect is an Effect which can be applied to all the frames of an
+// animation at once, so that it treats them consistently.
+type FramesEffect interface {
+	Effect
+	ApplyFrames([]image.Image) []image.Image
+}
+
+// applyFrames applies e to frames, at once if it's a FramesEffect.
+func applyFrames(e Effect, frames []image.Image) []image.Image {
+	if fe, ok := e.(FramesEffect); ok {
+		return fe.ApplyFrames(frames)
+	}
+	out := make([]image.Image, len(frames))
+	for i, frame := range frames {
+		out[i] = e.Apply(frame)
+	}
+	return out
+}
+
+// Func is an Effect implemented by a function.
+type Func func(image.Image) image.Image
+
+func (f Func) Apply(img image.Image) image.Image {
+	return f(img)
+}
+
+// Chain is an Effect which applies each of its effects in order.
+type Chain []Effect
+
+func (c Chain) Apply(img image.Image) image.Image {
+	for _, e := range c {
+		img = e.Apply(img)
+	}
+	return img
+}
+
+func (c Chain) ApplyFrames(frames []image.Image) []image.Image {
+	for _, e := range c {
+		frames = applyFrames(e, frames)
+	}
+	return frames
+}
+
+// Resize resizes images to w by h. If one of w or h is zero, the aspect ratio
+// is preserved.
+func Resize(w, h int) Effect {
+	return Func(func(img image.Image) image.Image {
+		return imaging.Resize(img, w, h, imaging.Lanczos)
+	})
+}
+
+// Rotate rotates images clockwise by deg degrees. Corners uncovered by the
+// rotation are transparent.
+func Rotate(deg float64) Effect {
+	return Func(func(img image.Image) image.Image {
+		switch math.Mod(deg+360, 360) {
+		case 0:
+			return img
+		case 90:
+			return imaging.Rotate270(img)
+		case 180:
+			return imaging.Rotate180(img)
+		case 270:
+			return imaging.Rotate90(img)
+		}
+		return imaging.Rotate(img, -deg, color.Transparent)
+	})
+}
+
+// FlipH flips images horizontally.
+func FlipH() Effect {
+	return Func(func(img image.Image) image.Image {
+		return imaging.FlipH(img)
+	})
+}
+
+// FlipV flips images vertically.
+func FlipV() Effect {
+	return Func(func(img image.Image) image.Image {
+		return imaging.FlipV(img)
+	})
+}
+
+// Blur applies a gaussian blur with the given standard deviation.
+func Blur(sigma float64) Effect {
+	return Func(func(img image.Image) image.Image {
+		return imaging.Blur(img, sigma)
+	})
+}
+
+// Sharpen sharpens images, sigma being the strength of the sharpening.
+func Sharpen(sigma float64) Effect {
+	return Func(func(img image.Image) image.Image {
+		return imaging.Sharpen(img, sigma)
+	})
+}
+
+// Pixelate replaces each size by size block of images with its average
+// colour.
+func Pixelate(size int) Effect {
+	return Func(func(img image.Image) image.Image {
+		b := img.Bounds()
+		w := (b.Dx() + size - 1) / size
+		h := (b.Dy() + size - 1) / size
+		small := imaging.Resize(img, w, h, imaging.Box)
+		return imaging.Resize(small, b.Dx(), b.Dy(), imaging.NearestNeighbor)
+	})
+}
+
+// Invert inverts the colours of images.
+func Invert() Effect {
+	return ColorEffect(func(c color.NRGBA) color.NRGBA {
+		return color.NRGBA{255 - c.R, 255 - c.G, 255 - c.B, c.A}
+	})
+}
+
+// Grayscale removes the colour from images.
+func Grayscale() Effect {
+	return ColorEffect(func(c color.NRGBA) color.NRGBA {
+		y := uint8(0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B) + 0.5)
+		return color.NRGBA{y, y, y, c.A}
+	})
+}
+
+// Posterize reduces each colour channel to the given number of levels.
+func Posterize(levels int) Effect {
+	step := 255 / float64(levels-1)
+	post := func(v uint8) uint8 {
+		return uint8(math.Round(math.Round(float64(v)/step) * step))
+	}
+	return ColorEffect(func(c color.NRGBA) color.NRGBA {
+		return color.NRGBA{post(c.R), post(c.G), post(c.B), c.A}
+	})
+}
+
+// JPEGCrush encodes images as JPEGs of the given quality, from 1 to 100,
+// and decodes them again, for deep fried memes.
+func JPEGCrush(quality int) Effect {
+	return Func(func(img image.Image) image.Image {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return img
+		}
+		crushed, err := jpeg.Decode(&buf)
+		if err != nil {
+			return img
+		}
+		return crushed
+	})
+}
+
+// Parse parses a comma separated list of effects with their arguments, like
+// "blur 2, invert, resize 200x100".
+func Parse(s string) (Effect, error) {
+	var chain Chain
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, " ")
+		e, err := parseEffect(name, strings.TrimSpace(arg))
+		if err != nil {
+			return nil, fmt.Errorf("parsing effect \"%s\": %w", name, err)
+		}
+		chain = append(chain, e)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no effects given")
+	}
+	return chain, nil
+}
+
+func parseEffect(name, arg string) (Effect, error) {
+	// number parses arg as a number between min and max, returning def if
+	// arg is empty.
+	number := func(def, min, max float64) (float64, error) {
+		if arg == "" {
+			return def, nil
+		}
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return 0, err
+		}
+		if n < min || n > max {
+			return 0, fmt.Errorf("must be between %g and %g", min, max)
+		}
+		return n, nil
+	}
+	var n float64
+	var err error
+	switch name {
+	case "resize":
+		w, h, err := parseSize(arg)
+		if err != nil {
+			return nil, err
+		}
+		return Resize(w, h), nil
+	case "rotate":
+		n, err = number(90, -360, 360)
+		return Rotate(n), err
+	case "flip", "fliph":
+		return FlipH(), nil
+	case "flop", "flipv":
+		return FlipV(), nil
+	case "blur":
+		n, err = number(3, 0.1, 100)
+		return Blur(n), err
+	case "sharpen":
+		n, err = number(3, 0.1, 100)
+		return Sharpen(n), err
+	case "pixelate":
+		n, err = number(8, 2, 256)
+		return Pixelate(int(n)), err
+	case "invert":
+		return Invert(), nil
+	case "grayscale", "greyscale":
+		return Grayscale(), nil
+	case "posterize":
+		n, err = number(4, 2, 64)
+		return Posterize(int(n)), err
+	case "crush", "jpeg":
+		n, err = number(5, 1, 100)
+		return JPEGCrush(int(n)), err
+	case "swirl":
+		n, err = number(3, -20, 20)
+		return Swirl(n), err
+	case "bulge":
+		n, err = number(1, -0.9, 5)
+		return Bulge(n), err
+	case "pixelsort":
+		return parsePixelSort(arg)
+	case "dither":
+		return parseDither(arg)
+	case "magik":
+		n, err = number(5, 1, 10)
+		return Magik(n), err
+	case "carve":
+		w, h, err := parseSize(arg)
+		if err != nil {
+			return nil, err
+		}
+		return Carve(w, h), nil
+	}
+	return nil, errors.New("unknown effect")
+}
+
+// parseSize parses a size like "200x100", or "200x" or "x100" to leave one
+// dimension out.
+func parseSize(s string) (w, h int, err error) {
+	sw, sh, _ := strings.Cut(s, "x")
+	if sw != "" {
+		if w, err = strconv.Atoi(sw); err != nil {
+			return 0, 0, errors.New("size must look like 200x100 or 200x")
+		}
+	}
+	if sh != "" {
+		if h, err = strconv.Atoi(sh); err != nil {
+			return 0, 0, errors.New("size must look like 200x100 or 200x")
+		}
+	}
+	if w < 0 || h < 0 || w > 4096 || h > 4096 || w+h == 0 {
+		return 0, 0, errors.New("size must be between 1 and 4096")
+	}
+	return w, h, nil
+}
+
+// parsePixelSort parses the arguments of pixelsort: "hue" to sort by hue
+// instead of brightness, "vertical" to sort columns, and a brightness range
+// like "0.25-0.8" for the pixels which are sorted.
+func parsePixelSort(arg string) (Effect, error) {
+	opts := PixelSortOptions{Low: 0.25, High: 0.8}
+	for _, f := range strings.Fields(arg) {
+		switch f {
+		case "brightness":
+			opts.Key = SortBrightness
+		case "hue":
+			opts.Key = SortHue
+		case "horizontal", "rows":
+			opts.Vertical = false
+		case "vertical", "columns":
+			opts.Vertical = true
+		default:
+			slow, shigh, ok := strings.Cut(f, "-")
+			low, err1 := strconv.ParseFloat(slow, 64)
+			high, err2 := strconv.ParseFloat(shigh, 64)
+			if !ok || err1 != nil || err2 != nil || low < 0 || high > 1 || low > high {
+				return nil, fmt.Errorf("invalid argument \"%s\"", f)
+			}
+			opts.Low, opts.High = low, high
+		}
+	}
+	return PixelSort(opts), nil
+}
+
+// parseDither parses the arguments of dither: the name of one of Palettes,
+// and "ordered" to use ordered dithering.
+func parseDither(arg string) (Effect, error) {
+	pal := Palettes["1bit"]
+	method := DitherFloydSteinberg
+	for _, f := range strings.Fields(arg) {
+		if f == "ordered" {
+			method = DitherOrdered
+			continue
+		}
+		var ok bool
+		if pal, ok = Palettes[f]; !ok {
+			return nil, fmt.Errorf("unknown palette \"%s\", try one of %s", f,
+				strings.Join(PaletteNames(), ", "))
+		}
+	}
+	return Dither(pal, method), nil
+}
@@ -0,0 +1,282 @@
+package imagefx
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"slices"
+	"testing"
+)
+
+func testGIF() *gif.GIF {
+	pal := color.Palette{color.Black, color.White, color.Transparent}
+	g := &gif.GIF{
+		Config:    image.Config{Width: 4, Height: 2},
+		Delay:     []int{5, 10, 20},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious},
+		LoopCount: 3,
+	}
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(i, 0, i+2, 2), pal)
+		for j := range frame.Pix {
+			frame.Pix[j] = uint8(j % 2)
+		}
+		g.Image = append(g.Image, frame)
+	}
+	return g
+}
+
+func checkTiming(t *testing.T, in, out *gif.GIF) {
+	t.Helper()
+	if len(out.Image) != len(in.Image) {
+		t.Fatalf("got %d frames, want %d", len(out.Image), len(in.Image))
+	}
+	for i := range in.Delay {
+		if out.Delay[i] != in.Delay[i] || out.Disposal[i] != in.Disposal[i] {
+			t.Errorf("frame %d: got delay %d disposal %d, want %d %d", i,
+				out.Delay[i], out.Disposal[i], in.Delay[i], in.Disposal[i])
+		}
+	}
+	if out.LoopCount != in.LoopCount {
+		t.Errorf("got loop count %d, want %d", out.LoopCount, in.LoopCount)
+	}
+}
+
+func TestApplyGIFColor(t *testing.T) {
+	g := testGIF()
+	out := ApplyGIF(g, Invert())
+	checkTiming(t, g, out)
+	for i, frame := range out.Image {
+		if frame.Rect != g.Image[i].Rect {
+			t.Errorf("frame %d: bounds changed from %v to %v", i, g.Image[i].Rect, frame.Rect)
+		}
+		r, _, _, _ := frame.Palette[0].RGBA()
+		if r != 0xffff {
+			t.Errorf("frame %d: black wasn't inverted", i)
+		}
+	}
+}
+
+func TestApplyGIFResize(t *testing.T) {
+	g := testGIF()
+	out := ApplyGIF(g, Resize(8, 4))
+	checkTiming(t, g, out)
+	for i, frame := range out.Image {
+		if frame.Rect != image.Rect(0, 0, 8, 4) {
+			t.Errorf("frame %d: got bounds %v, want full 8x4 frame", i, frame.Rect)
+		}
+	}
+	if out.Config.Width != 8 || out.Config.Height != 4 {
+		t.Errorf("got size %dx%d, want 8x4", out.Config.Width, out.Config.Height)
+	}
+}
+
+func TestApplyGIFColorAndSpatial(t *testing.T) {
+	red, blue := color.NRGBA{0xff, 0, 0, 0xff}, color.NRGBA{0, 0, 0xff, 0xff}
+	frame := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{red, blue})
+	for i := range frame.Pix {
+		frame.Pix[i] = uint8(i % 2)
+	}
+	g := &gif.GIF{Image: []*image.Paletted{frame}, Delay: []int{10},
+		Config: image.Config{Width: 4, Height: 4}}
+	for _, tt := range []struct {
+		effect Effect
+		ok     func(r, g, b uint8) bool
+	}{
+		{Chain{Grayscale(), FlipH()}, func(r, g, b uint8) bool { return r == g && g == b }},
+		{Chain{Invert(), Rotate(180)}, func(r, g, b uint8) bool {
+			return r == 0 && g == 0xff && b == 0xff || r == 0xff && g == 0xff && b == 0
+		}},
+		{Chain{Dither(Palettes["gameboy"], DitherFloydSteinberg), FlipH()}, func(r, g, b uint8) bool {
+			return slices.Contains(Palettes["gameboy"], color.Color(color.NRGBA{r, g, b, 0xff}))
+		}},
+	} {
+		out := ApplyGIF(g, tt.effect)
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				c := color.NRGBAModel.Convert(out.Image[0].At(x, y)).(color.NRGBA)
+				if !tt.ok(c.R, c.G, c.B) {
+					t.Errorf("%v: got %v at (%d, %d)", tt.effect, c, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			m.SetNRGBA(x, y, color.NRGBA{uint8(x * 4), uint8(y * 4), uint8(x + y), 0xff})
+		}
+	}
+	pal := quantize([]image.Image{m})
+	if len(pal) > 256 {
+		t.Fatalf("got %d colours", len(pal))
+	}
+	// every colour is close to one in the palette
+	for y := 0; y < 64; y += 3 {
+		for x := 0; x < 64; x += 3 {
+			c := m.NRGBAAt(x, y)
+			p := pal.Convert(c).(color.NRGBA)
+			d := max(abs(int(c.R)-int(p.R)), abs(int(c.G)-int(p.G)), abs(int(c.B)-int(p.B)))
+			if d > 24 {
+				t.Errorf("%v was mapped to %v", c, p)
+			}
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func TestRotate(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	img.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	rotated := Rotate(90).Apply(img)
+	if size := rotated.Bounds().Size(); size != image.Pt(2, 4) {
+		t.Fatalf("got size %v, want 2x4", size)
+	}
+	// rotating clockwise moves the top left corner to the top right
+	if r, _, _, _ := rotated.At(1, 0).RGBA(); r != 0xffff {
+		t.Error("image wasn't rotated clockwise")
+	}
+}
+
+func TestPosterize(t *testing.T) {
+	c := Posterize(2).(ColorEffect)(color.NRGBA{100, 200, 127, 255})
+	if c != (color.NRGBA{0, 255, 0, 255}) {
+		t.Errorf("got %v", c)
+	}
+}
+
+func TestParse(t *testing.T) {
+	e, err := Parse("blur 2, invert, resize 20x, swirl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.(Chain)) != 4 {
+		t.Errorf("got %d effects, want 4", len(e.(Chain)))
+	}
+	for _, s := range []string{"", "explode", "blur lots", "resize 0x0", "posterize 1"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q): expected error", s)
+		}
+	}
+}
+
+func TestDistortionKeepsSize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 9, 7))
+	for _, e := range []Effect{Swirl(3), Bulge(1), Bulge(-0.5)} {
+		if b := e.Apply(img).Bounds(); b != img.Bounds() {
+			t.Errorf("got bounds %v, want %v", b, img.Bounds())
+		}
+	}
+}
+
+func TestCarveSize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	for _, size := range []image.Point{{12, 10}, {20, 4}, {30, 15}, {5, 25}} {
+		got := Carve(size.X, size.Y).Apply(img).Bounds().Size()
+		if got != size {
+			t.Errorf("carving to %v: got size %v", size, got)
+		}
+	}
+}
+
+func TestSeamMaskAvoidsDetail(t *testing.T) {
+	// a map with high energy in every column but 2 and 5
+	w, h := 8, 6
+	e := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x != 2 && x != 5 {
+				e[y*w+x] = 100
+			}
+		}
+	}
+	mask := seamMask(e, w, h, 2)
+	for y, row := range mask {
+		for x, set := range row {
+			if set != (x == 2 || x == 5) {
+				t.Errorf("row %d: got column %d set %v", y, x, set)
+			}
+		}
+	}
+}
+
+func TestMagikGIFConsistent(t *testing.T) {
+	pal := color.Palette{color.Black, color.White}
+	g := &gif.GIF{
+		Config: image.Config{Width: 16, Height: 16},
+		Delay:  []int{10, 10},
+	}
+	for i := 0; i < 2; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 16, 16), pal)
+		for j := range frame.Pix {
+			frame.Pix[j] = uint8(j / 3 % 2)
+		}
+		g.Image = append(g.Image, frame)
+	}
+	out := ApplyGIF(g, Magik(5))
+	a, b := out.Image[0], out.Image[1]
+	if a.Rect != image.Rect(0, 0, 16, 16) {
+		t.Fatalf("got bounds %v, want the original 16x16", a.Rect)
+	}
+	for i := range a.Pix {
+		if a.Palette[a.Pix[i]] != b.Palette[b.Pix[i]] {
+			t.Fatal("identical frames were carved differently")
+		}
+	}
+}
+
+func TestPixelSort(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 5, 1))
+	// the black pixel in the middle is outside of the range, so the pixels
+	// on either side of it are sorted separately
+	for x, v := range []uint8{200, 100, 0, 250, 150} {
+		img.SetNRGBA(x, 0, color.NRGBA{v, v, v, 255})
+	}
+	out := PixelSort(PixelSortOptions{Low: 0.1, High: 1}).Apply(img).(*image.NRGBA)
+	for x, want := range []uint8{100, 200, 0, 150, 250} {
+		if got := out.NRGBAAt(x, 0).R; got != want {
+			t.Errorf("pixel %d: got %d, want %d", x, got, want)
+		}
+	}
+}
+
+func TestDither(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = 128
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+	img.SetNRGBA(0, 0, color.NRGBA{})
+	pal := Palettes["gameboy"]
+	for _, method := range []DitherMethod{DitherFloydSteinberg, DitherOrdered} {
+		out := Dither(pal, method).Apply(img).(*image.Paletted)
+		if _, _, _, a := out.At(0, 0).RGBA(); a != 0 {
+			t.Errorf("method %d: transparent pixel became opaque", method)
+		}
+		used := make(map[uint8]bool)
+		for _, i := range out.Pix[1:] {
+			used[i] = true
+			if int(i) >= len(pal) {
+				t.Fatalf("method %d: opaque pixel became transparent", method)
+			}
+		}
+		if len(used) < 2 {
+			t.Errorf("method %d: got %d colours, want grey to be dithered",
+				method, len(used))
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package imagefx
+
+import (
+	"image"
+	"image/color"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// SortKey is what PixelSort sorts pixels by.
+type SortKey int
+
+const (
+	SortBrightness SortKey = iota
+	SortHue
+)
+
+type PixelSortOptions struct {
+	Key SortKey
+	// Vertical sorts the columns of images instead of their rows.
+	Vertical bool
+	// Low and High are the range of brightness, from 0 to 1, of the pixels
+	// which are sorted. Pixels outside of it split rows into separately
+	// sorted runs and stay where they are.
+	Low, High float64
+}
+
+// PixelSort sorts runs of pixels along the rows or columns of images.
+func PixelSort(opts PixelSortOptions) Effect {
+	return Func(func(img image.Image) image.Image {
+		dst := imaging.Clone(img)
+		if opts.Vertical {
+			dst = imaging.Transpose(dst)
+		}
+		key := brightness
+		if opts.Key == SortHue {
+			key = hue
+		}
+		w, h := dst.Rect.Dx(), dst.Rect.Dy()
+		run := make([]color.NRGBA, 0, w)
+		for y := 0; y < h; y++ {
+			row := dst.Pix[y*dst.Stride : y*dst.Stride+w*4]
+			start := -1
+			for x := 0; x <= w; x++ {
+				in := false
+				if x < w {
+					b := brightness(pixelAt(row, x))
+					in = b >= opts.Low && b <= opts.High
+				}
+				if in && start < 0 {
+					start = x
+				}
+				if !in && start >= 0 {
+					run = run[:0]
+					for i := start; i < x; i++ {
+						run = append(run, pixelAt(row, i))
+					}
+					sort.SliceStable(run, func(i, j int) bool {
+						return key(run[i]) < key(run[j])
+					})
+					for i, c := range run {
+						copy(row[(start+i)*4:], []uint8{c.R, c.G, c.B, c.A})
+					}
+					start = -1
+				}
+			}
+		}
+		if opts.Vertical {
+			dst = imaging.Transpose(dst)
+		}
+		return dst
+	})
+}
+
+func pixelAt(row []uint8, x int) color.NRGBA {
+	p := row[x*4 : x*4+4]
+	return color.NRGBA{p[0], p[1], p[2], p[3]}
+}
+
+// brightness returns the luma of c from 0 to 1.
+func brightness(c color.NRGBA) float64 {
+	return (0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)) / 255
+}
+
+// hue returns the hue of c from 0 to 1.
+func hue(c color.NRGBA) float64 {
+	r, g, b := float64(c.R), float64(c.G), float64(c.B)
+	hi := max(r, g, b)
+	d := hi - min(r, g, b)
+	if d == 0 {
+		return 0
+	}
+	var h float64
+	switch hi {
+	case r:
+		h = (g - b) / d
+		if h < 0 {
+			h += 6
+		}
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h / 6
+}
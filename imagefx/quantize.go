@@ -0,0 +1,133 @@
+package imagefx
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// maxPaletteSamples is about how many pixels quantize looks at.
+const maxPaletteSamples = 1 << 18
+
+type colorCount struct {
+	c [3]uint8
+	n int
+}
+
+// quantize chooses a palette of up to 256 colours for imgs by median cut,
+// with a transparent colour if any of their pixels are mostly transparent.
+// Images with few enough colours get a palette of exactly their colours.
+func quantize(imgs []image.Image) color.Palette {
+	var total int
+	for _, img := range imgs {
+		total += img.Bounds().Dx() * img.Bounds().Dy()
+	}
+	step := max(total/maxPaletteSamples, 1)
+	counts := make(map[[3]uint8]int)
+	var transparent bool
+	var i int
+	for _, img := range imgs {
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if i++; i%step != 0 {
+					continue
+				}
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				if c.A < 0x80 {
+					transparent = true
+					continue
+				}
+				counts[[3]uint8{c.R, c.G, c.B}]++
+			}
+		}
+	}
+	size := 256
+	if transparent {
+		size--
+	}
+	colors := make([]colorCount, 0, len(counts))
+	for c, n := range counts {
+		colors = append(colors, colorCount{c, n})
+	}
+	// sorted so that the palette doesn't depend on the order of the map
+	sort.Slice(colors, func(i, j int) bool {
+		a, b := colors[i].c, colors[j].c
+		return a[0] < b[0] || a[0] == b[0] && (a[1] < b[1] || a[1] == b[1] && a[2] < b[2])
+	})
+
+	var pal color.Palette
+	if len(colors) <= size {
+		for _, c := range colors {
+			pal = append(pal, color.NRGBA{c.c[0], c.c[1], c.c[2], 0xff})
+		}
+	} else {
+		for _, box := range medianCut(colors, size) {
+			pal = append(pal, box.mean())
+		}
+	}
+	if transparent || len(pal) == 0 {
+		pal = append(pal, color.Transparent)
+	}
+	return pal
+}
+
+type colorBox []colorCount
+
+// widest returns the channel the colours of b spread over most and how far.
+func (b colorBox) widest() (channel int, spread int) {
+	for ch := 0; ch < 3; ch++ {
+		lo, hi := 255, 0
+		for _, c := range b {
+			lo = min(lo, int(c.c[ch]))
+			hi = max(hi, int(c.c[ch]))
+		}
+		if hi-lo > spread {
+			channel, spread = ch, hi-lo
+		}
+	}
+	return channel, spread
+}
+
+func (b colorBox) mean() color.Color {
+	var sum [3]int
+	var n int
+	for _, c := range b {
+		for ch := range sum {
+			sum[ch] += int(c.c[ch]) * c.n
+		}
+		n += c.n
+	}
+	return color.NRGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), 0xff}
+}
+
+// medianCut splits colors into up to n boxes, each time splitting the box
+// spreading furthest along a channel at the median pixel along it.
+func medianCut(colors []colorCount, n int) []colorBox {
+	boxes := []colorBox{colors}
+	for len(boxes) < n {
+		best, bestCh, bestSpread := -1, 0, 0
+		for i, b := range boxes {
+			if ch, spread := b.widest(); len(b) > 1 && spread > bestSpread {
+				best, bestCh, bestSpread = i, ch, spread
+			}
+		}
+		if best < 0 {
+			break
+		}
+		b := boxes[best]
+		sort.SliceStable(b, func(i, j int) bool { return b[i].c[bestCh] < b[j].c[bestCh] })
+		var total int
+		for _, c := range b {
+			total += c.n
+		}
+		split, seen := 1, b[0].n
+		for split < len(b)-1 && seen < total/2 {
+			seen += b[split].n
+			split++
+		}
+		boxes[best] = b[:split]
+		boxes = append(boxes, b[split:])
+	}
+	return boxes
+}
@@ -0,0 +1,245 @@
+package imagefx
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// Carve resizes images to w by h by seam carving: instead of scaling them
+// uniformly, the connected paths of pixels with the least detail are removed,
+// or duplicated to grow images. If one of w or h is zero, that dimension is
+// kept.
+//
+// When applied to the frames of a GIF, the same seams are used for every
+// frame so that nothing jitters.
+func Carve(w, h int) Effect {
+	return carver{w, h}
+}
+
+type carver struct {
+	w, h int
+}
+
+func (c carver) Apply(img image.Image) image.Image {
+	return c.ApplyFrames([]image.Image{img})[0]
+}
+
+func (c carver) ApplyFrames(frames []image.Image) []image.Image {
+	nrgba := make([]*image.NRGBA, len(frames))
+	for i, frame := range frames {
+		nrgba[i] = imaging.Clone(frame)
+	}
+	size := nrgba[0].Bounds().Size()
+	w, h := c.w, c.h
+	if w <= 0 {
+		w = size.X
+	}
+	if h <= 0 {
+		h = size.Y
+	}
+	nrgba = carveWidth(nrgba, w)
+	// horizontal seams are found as vertical seams of the transposed frames
+	for i, frame := range nrgba {
+		nrgba[i] = imaging.Transpose(frame)
+	}
+	nrgba = carveWidth(nrgba, h)
+	out := make([]image.Image, len(nrgba))
+	for i, frame := range nrgba {
+		out[i] = imaging.Transpose(frame)
+	}
+	return out
+}
+
+// Magik is the "magik" meme: images are shrunk by seam carving, by more the
+// higher strength is, from 1 to 10, then scaled back to their original size.
+// Everything but the most detailed parts of them ends up warped.
+func Magik(strength float64) Effect {
+	return magik(strength)
+}
+
+type magik float64
+
+// magikMaxSize is the largest width or height images are carved at by Magik,
+// as seam carving is slow and the result is blurry anyway.
+const magikMaxSize = 512
+
+func (m magik) Apply(img image.Image) image.Image {
+	return m.ApplyFrames([]image.Image{img})[0]
+}
+
+func (m magik) ApplyFrames(frames []image.Image) []image.Image {
+	orig := frames[0].Bounds().Size()
+	frames = append([]image.Image(nil), frames...)
+	if orig.X > magikMaxSize || orig.Y > magikMaxSize {
+		for i, frame := range frames {
+			frames[i] = imaging.Fit(frame, magikMaxSize, magikMaxSize,
+				imaging.Linear)
+		}
+	}
+	size := frames[0].Bounds().Size()
+	scale := 1 - 0.06*float64(m)
+	w := max(int(float64(size.X)*scale), 1)
+	h := max(int(float64(size.Y)*scale), 1)
+	frames = carver{w, h}.ApplyFrames(frames)
+	for i, frame := range frames {
+		frames[i] = imaging.Resize(frame, orig.X, orig.Y, imaging.Linear)
+	}
+	return frames
+}
+
+// carveWidth removes or inserts vertical seams in frames, which all have the
+// same size, until they're w pixels wide.
+func carveWidth(frames []*image.NRGBA, w int) []*image.NRGBA {
+	for {
+		size := frames[0].Bounds().Size()
+		n, grow := size.X-w, false
+		if n < 0 {
+			n, grow = -n, true
+		}
+		// at most every column but one can be removed or duplicated at once
+		n = min(n, size.X-1)
+		if n <= 0 {
+			return frames
+		}
+		e := make([]float64, size.X*size.Y)
+		for _, frame := range frames {
+			for i, v := range energy(frame) {
+				e[i] += v
+			}
+		}
+		mask := seamMask(e, size.X, size.Y, n)
+		for i, frame := range frames {
+			frames[i] = carveColumns(frame, mask, n, grow)
+		}
+	}
+}
+
+// energy returns how much detail there is at each pixel of img, as the sum
+// of the differences between the channels of its neighbours.
+func energy(img *image.NRGBA) []float64 {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	at := func(x, y int) []uint8 {
+		x = min(max(x, 0), w-1)
+		y = min(max(y, 0), h-1)
+		i := y*img.Stride + x*4
+		return img.Pix[i : i+4]
+	}
+	diff := func(a, b []uint8) float64 {
+		var d int
+		for i := range a {
+			if a[i] > b[i] {
+				d += int(a[i] - b[i])
+			} else {
+				d += int(b[i] - a[i])
+			}
+		}
+		return float64(d)
+	}
+	e := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			e[y*w+x] = diff(at(x-1, y), at(x+1, y)) + diff(at(x, y-1), at(x, y+1))
+		}
+	}
+	return e
+}
+
+// seamMask finds n vertical seams of least energy in an energy map of width w
+// and height h, returning for each row which of its columns the seams go
+// through. Each seam is removed from the map before the next one is found,
+// so seams never share a pixel.
+func seamMask(energy []float64, w, h, n int) [][]bool {
+	e := append([]float64(nil), energy...)
+	// cols holds the original column of each entry of e, as entries are
+	// shifted left when seams are removed
+	cols := make([]int, w*h)
+	for i := range cols {
+		cols[i] = i % w
+	}
+	mask := make([][]bool, h)
+	for y := range mask {
+		mask[y] = make([]bool, w)
+	}
+	cost := make([]float64, w*h)
+	seam := make([]int, h)
+	for cw := w; n > 0 && cw > 1; n, cw = n-1, cw-1 {
+		// cost holds the least total energy of a seam from the top row to
+		// each pixel
+		copy(cost[:cw], e[:cw])
+		for y := 1; y < h; y++ {
+			prev := cost[(y-1)*w : (y-1)*w+cw]
+			for x := 0; x < cw; x++ {
+				best := prev[x]
+				if x > 0 && prev[x-1] < best {
+					best = prev[x-1]
+				}
+				if x < cw-1 && prev[x+1] < best {
+					best = prev[x+1]
+				}
+				cost[y*w+x] = e[y*w+x] + best
+			}
+		}
+		last := cost[(h-1)*w : (h-1)*w+cw]
+		seam[h-1] = 0
+		for x := range last {
+			if last[x] < last[seam[h-1]] {
+				seam[h-1] = x
+			}
+		}
+		for y := h - 2; y >= 0; y-- {
+			row := cost[y*w : y*w+cw]
+			px := seam[y+1]
+			x := px
+			if px > 0 && row[px-1] < row[x] {
+				x = px - 1
+			}
+			if px < cw-1 && row[px+1] < row[x] {
+				x = px + 1
+			}
+			seam[y] = x
+		}
+		for y, x := range seam {
+			i := y * w
+			mask[y][cols[i+x]] = true
+			copy(e[i+x:i+cw-1], e[i+x+1:i+cw])
+			copy(cols[i+x:i+cw-1], cols[i+x+1:i+cw])
+		}
+	}
+	return mask
+}
+
+// carveColumns removes the pixels of img set in mask, or if grow is true,
+// duplicates them, blending each copy with the pixel to its right. Every row
+// of mask must have n pixels set.
+func carveColumns(img *image.NRGBA, mask [][]bool, n int, grow bool) *image.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	nw := w - n
+	if grow {
+		nw = w + n
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, nw, h))
+	for y := 0; y < h; y++ {
+		src := img.Pix[y*img.Stride : y*img.Stride+w*4]
+		out := dst.Pix[y*dst.Stride : y*dst.Stride+nw*4]
+		var o int
+		for x := 0; x < w; x++ {
+			p := src[x*4 : x*4+4]
+			if !mask[y][x] || grow {
+				copy(out[o:o+4], p)
+				o += 4
+			}
+			if mask[y][x] && grow {
+				q := p
+				if x+1 < w {
+					q = src[x*4+4 : x*4+8]
+				}
+				for i := range p {
+					out[o+i] = uint8((int(p[i]) + int(q[i])) / 2)
+				}
+				o += 4
+			}
+		}
+	}
+	return dst
+}
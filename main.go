@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"samhza.com/esammy/discordbot"
+	"samhza.com/esammy/memegen"
 
 	"github.com/diamondburned/arikawa/v3/utils/bot"
 	"github.com/pelletier/go-toml"
@@ -46,6 +47,9 @@ func main() {
 		log.Fatalln(err)
 	}
 	log.Println("Bot started")
+	if config.EmojiDir == "" && !memegen.HasBundledEmoji() {
+		log.Println("No emoji images are built in and emoji-dir isn't set, so Unicode emoji will be drawn as text")
+	}
 
 	if err := wait(); err != nil {
 		log.Fatalln("Gateway fatal error:", err)
@@ -0,0 +1,136 @@
+package memegen
+
+import (
+	"strings"
+	"unicode"
+)
+
+// arabicForm is how an Arabic letter is shaped, with the presentation forms
+// of a letter being consecutive: isolated, final, then for letters joining
+// on both sides, initial and medial.
+type arabicForm struct {
+	isolated rune
+	// dual is true for letters which join to the letters on both sides of
+	// them, rather than only the one before them.
+	dual bool
+}
+
+var arabicForms = map[rune]arabicForm{
+	'ء': {0xfe80, false},
+	'آ': {0xfe81, false},
+	'أ': {0xfe83, false},
+	'ؤ': {0xfe85, false},
+	'إ': {0xfe87, false},
+	'ئ': {0xfe89, true},
+	'ا': {0xfe8d, false},
+	'ب': {0xfe8f, true},
+	'ة': {0xfe93, false},
+	'ت': {0xfe95, true},
+	'ث': {0xfe99, true},
+	'ج': {0xfe9d, true},
+	'ح': {0xfea1, true},
+	'خ': {0xfea5, true},
+	'د': {0xfea9, false},
+	'ذ': {0xfeab, false},
+	'ر': {0xfead, false},
+	'ز': {0xfeaf, false},
+	'س': {0xfeb1, true},
+	'ش': {0xfeb5, true},
+	'ص': {0xfeb9, true},
+	'ض': {0xfebd, true},
+	'ط': {0xfec1, true},
+	'ظ': {0xfec5, true},
+	'ع': {0xfec9, true},
+	'غ': {0xfecd, true},
+	'ف': {0xfed1, true},
+	'ق': {0xfed5, true},
+	'ك': {0xfed9, true},
+	'ل': {0xfedd, true},
+	'م': {0xfee1, true},
+	'ن': {0xfee5, true},
+	'ه': {0xfee9, true},
+	'و': {0xfeed, false},
+	'ى': {0xfeef, false},
+	'ي': {0xfef1, true},
+	// Persian
+	'پ': {0xfb56, true},
+	'چ': {0xfb7a, true},
+	'ژ': {0xfb8a, false},
+	'ک': {0xfb8e, true},
+	'گ': {0xfb92, true},
+	'ی': {0xfbfc, true},
+}
+
+// lamAlef are the isolated forms of the ligatures of lam with each alef.
+var lamAlef = map[rune]rune{
+	'آ': 0xfef5,
+	'أ': 0xfef7,
+	'إ': 0xfef9,
+	'ا': 0xfefb,
+}
+
+const (
+	lam     = 'ل'
+	tatweel = 'ـ'
+	hamza   = 'ء'
+)
+
+// joinsNext reports whether r connects to the letter after it.
+func joinsNext(r rune) bool {
+	return r == tatweel || arabicForms[r].dual
+}
+
+// joinsPrev reports whether r connects to the letter before it.
+func joinsPrev(r rune) bool {
+	_, ok := arabicForms[r]
+	return r == tatweel || (ok && r != hamza)
+}
+
+// shapeArabic replaces the Arabic letters of s with the presentation forms
+// for their position in words, as fonts don't do this themselves when drawn
+// with font.Drawer.
+func shapeArabic(s string) string {
+	runes := []rune(s)
+	// neighbour returns the first letter from i in the direction of step,
+	// skipping over marks, or 0 if there is none.
+	neighbour := func(i, step int) rune {
+		for i += step; i >= 0 && i < len(runes); i += step {
+			if !unicode.Is(unicode.Mn, runes[i]) {
+				return runes[i]
+			}
+		}
+		return 0
+	}
+	var b strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		form, ok := arabicForms[r]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		prev := joinsNext(neighbour(i, -1)) && joinsPrev(r)
+		if r == lam && i+1 < len(runes) {
+			if lig, ok := lamAlef[runes[i+1]]; ok {
+				if prev {
+					lig++
+				}
+				b.WriteRune(lig)
+				i++
+				continue
+			}
+		}
+		next := form.dual && joinsPrev(neighbour(i, 1))
+		switch {
+		case prev && next:
+			b.WriteRune(form.isolated + 3)
+		case next:
+			b.WriteRune(form.isolated + 2)
+		case prev:
+			b.WriteRune(form.isolated + 1)
+		default:
+			b.WriteRune(form.isolated)
+		}
+	}
+	return b.String()
+}
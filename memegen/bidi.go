@@ -0,0 +1,266 @@
+package memegen
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+// This file implements the parts of the Unicode bidirectional algorithm
+// captions need: the direction of paragraphs, and the order in which the
+// characters of a line are drawn. Explicit embeddings and isolates are
+// ignored.
+
+// bidiClass returns the bidi class of r.
+func bidiClass(r rune) bidi.Class {
+	props, _ := bidi.LookupRune(r)
+	return props.Class()
+}
+
+// isRTL reports whether the paragraph s is right-to-left, which it is if its
+// first strongly directional character is.
+func isRTL(s string) bool {
+	for _, r := range s {
+		switch bidiClass(r) {
+		case bidi.L:
+			return false
+		case bidi.R, bidi.AL:
+			return true
+		}
+	}
+	return false
+}
+
+// cluster is a character along with the marks following it, or an emoji,
+// which are kept together when reordering.
+type cluster struct {
+	text  string
+	class bidi.Class
+	level int
+	// pos is where the cluster starts in the string it's from
+	pos int
+}
+
+func clusters(s string) []cluster {
+	var cs []cluster
+	var pos int
+	for _, seg := range splitEmoji(s) {
+		if seg.emoji != nil {
+			cs = append(cs, cluster{text: seg.text, class: bidi.ON, pos: pos})
+			pos += len(seg.text)
+			continue
+		}
+		for i, r := range seg.text {
+			class := bidiClass(r)
+			size := utf8.RuneLen(r)
+			joiner := r == '\u200d' || (r >= '\ufe00' && r <= '\ufe0f')
+			if (class == bidi.NSM || joiner) && len(cs) > 0 {
+				cs[len(cs)-1].text += seg.text[i : i+size]
+				continue
+			}
+			if class == bidi.NSM {
+				class = bidi.ON
+			}
+			cs = append(cs, cluster{text: seg.text[i : i+size], class: class, pos: pos + i})
+		}
+		pos += len(seg.text)
+	}
+	return cs
+}
+
+// isNeutral reports whether c is a neutral or separator class once weak types
+// are resolved.
+func isNeutral(c bidi.Class) bool {
+	switch c {
+	case bidi.L, bidi.R, bidi.EN, bidi.AN:
+		return false
+	}
+	return true
+}
+
+// visualOrder returns the line s in the order its characters are drawn in,
+// from left to right, for a paragraph which is right-to-left if rtl is true.
+// Brackets in right-to-left text are mirrored.
+func visualOrder(s string, rtl bool) string {
+	var b strings.Builder
+	for _, c := range visualClusters(s, rtl) {
+		b.WriteString(c.text)
+	}
+	return b.String()
+}
+
+// visualClusters is like visualOrder, but returns the clusters of s in the
+// order they're drawn in.
+func visualClusters(s string, rtl bool) []cluster {
+	cs := clusters(s)
+	base := 0
+	if rtl {
+		base = 1
+	}
+	resolveWeak(cs, rtl)
+	resolveNeutral(cs, rtl)
+
+	// implicit levels
+	maxLevel := base
+	for i := range cs {
+		c := &cs[i]
+		c.level = base
+		switch {
+		case base == 0 && c.class == bidi.R:
+			c.level = 1
+		case base == 0 && (c.class == bidi.EN || c.class == bidi.AN):
+			c.level = 2
+		case base == 1 && c.class != bidi.R:
+			c.level = 2
+		}
+		maxLevel = max(maxLevel, c.level)
+	}
+	// trailing whitespace goes back to the paragraph level
+	for i := len(cs) - 1; i >= 0 && unicode.IsSpace(firstRune(cs[i].text)); i-- {
+		cs[i].level = base
+	}
+	for i := range cs {
+		if cs[i].level%2 == 1 && utf8.RuneCountInString(cs[i].text) == 1 {
+			cs[i].text = bidi.ReverseString(cs[i].text)
+		}
+	}
+
+	// from the highest level down to the lowest odd one, every run of
+	// clusters at that level or higher is reversed
+	for level := maxLevel; level >= 1; level-- {
+		for i := 0; i < len(cs); {
+			if cs[i].level < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(cs) && cs[j].level >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				cs[a], cs[b] = cs[b], cs[a]
+			}
+			i = j
+		}
+	}
+	return cs
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+// resolveWeak resolves the classes of numbers and separators, leaving only
+// L, R, EN, AN and neutrals.
+func resolveWeak(cs []cluster, rtl bool) {
+	sos := bidi.L
+	if rtl {
+		sos = bidi.R
+	}
+	// European numbers after Arabic letters are Arabic numbers, and
+	// Arabic letters are otherwise right-to-left
+	last := sos
+	for i := range cs {
+		switch cs[i].class {
+		case bidi.L, bidi.R, bidi.AL:
+			last = cs[i].class
+		case bidi.EN:
+			if last == bidi.AL {
+				cs[i].class = bidi.AN
+			}
+		}
+	}
+	for i := range cs {
+		if cs[i].class == bidi.AL {
+			cs[i].class = bidi.R
+		}
+	}
+	// a single separator between two numbers of the same type joins them
+	for i := 1; i < len(cs)-1; i++ {
+		prev, next := cs[i-1].class, cs[i+1].class
+		switch cs[i].class {
+		case bidi.ES:
+			if prev == bidi.EN && next == bidi.EN {
+				cs[i].class = bidi.EN
+			}
+		case bidi.CS:
+			if prev == next && (prev == bidi.EN || prev == bidi.AN) {
+				cs[i].class = prev
+			}
+		}
+	}
+	// terminators like currency signs next to European numbers are part
+	// of them
+	for i := 0; i < len(cs); {
+		if cs[i].class != bidi.ET {
+			i++
+			continue
+		}
+		j := i
+		for j < len(cs) && cs[j].class == bidi.ET {
+			j++
+		}
+		if (i > 0 && cs[i-1].class == bidi.EN) || (j < len(cs) && cs[j].class == bidi.EN) {
+			for k := i; k < j; k++ {
+				cs[k].class = bidi.EN
+			}
+		}
+		i = j
+	}
+	// European numbers in left-to-right text are left-to-right
+	last = sos
+	for i := range cs {
+		switch cs[i].class {
+		case bidi.L, bidi.R:
+			last = cs[i].class
+		case bidi.EN:
+			if last == bidi.L {
+				cs[i].class = bidi.L
+			}
+		}
+	}
+}
+
+// resolveNeutral gives neutrals the direction of the text around them if it
+// has the same direction on both sides, or that of the paragraph otherwise.
+// Numbers count as right-to-left text.
+func resolveNeutral(cs []cluster, rtl bool) {
+	dir := func(c bidi.Class) bidi.Class {
+		if c == bidi.EN || c == bidi.AN {
+			return bidi.R
+		}
+		return c
+	}
+	e := bidi.L
+	if rtl {
+		e = bidi.R
+	}
+	for i := 0; i < len(cs); {
+		if !isNeutral(cs[i].class) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(cs) && isNeutral(cs[j].class) {
+			j++
+		}
+		before, after := e, e
+		if i > 0 {
+			before = dir(cs[i-1].class)
+		}
+		if j < len(cs) {
+			after = dir(cs[j].class)
+		}
+		class := e
+		if before == after {
+			class = before
+		}
+		for k := i; k < j; k++ {
+			cs[k].class = class
+		}
+		i = j
+	}
+}
@@ -0,0 +1,200 @@
+package memegen
+
+import (
+	"image"
+	"image/draw"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/f32"
+	"golang.org/x/image/math/fixed"
+)
+
+// maxCachedFaces is how many faces are kept before the cache is emptied.
+const maxCachedFaces = 64
+
+type faceKey struct {
+	style   string
+	variant Variant
+	size    float64
+}
+
+var faceCache = struct {
+	sync.Mutex
+	faces map[faceKey]*cachedFace
+}{faces: make(map[faceKey]*cachedFace)}
+
+// newFace returns a face of a style at the given size, reusing faces made
+// before so that their glyphs only have to be rasterized once. The face is
+// safe for concurrent use.
+func newFace(style string, size float64) font.Face {
+	return newVariantFace(style, 0, size)
+}
+
+// newVariantFace is like newFace, but for a variant of the style.
+func newVariantFace(style string, v Variant, size float64) font.Face {
+	key := faceKey{style, v, size}
+	faceCache.Lock()
+	defer faceCache.Unlock()
+	if f, ok := faceCache.faces[key]; ok {
+		return f
+	}
+	if len(faceCache.faces) >= maxCachedFaces {
+		clear(faceCache.faces)
+	}
+	f := newCachedFace(makeFace(style, v, size))
+	faceCache.faces[key] = f
+	return f
+}
+
+// clearFaceCache empties the face cache, for when the fallback or variant
+// fonts change.
+func clearFaceCache() {
+	faceCache.Lock()
+	clear(faceCache.faces)
+	faceCache.Unlock()
+}
+
+// cachedFace is a font.Face which keeps the masks and advances of the glyphs
+// of another face. Glyphs are cached at a quarter pixel horizontally, which
+// is as finely as truetype renders them by default.
+type cachedFace struct {
+	mu       sync.RWMutex
+	face     font.Face
+	metrics  font.Metrics
+	glyphs   map[glyphKey]glyph
+	advances map[rune]glyphAdvance
+	kerns    map[[2]rune]fixed.Int26_6
+	outlines map[rune][][]f32.Vec2
+}
+
+type glyphKey struct {
+	r rune
+	// x and y are the fractional parts of the dot the glyph is drawn at
+	x, y fixed.Int26_6
+}
+
+type glyph struct {
+	// dr is relative to the integer part of the dot, and mask has the same
+	// bounds as dr
+	dr      image.Rectangle
+	mask    *image.Alpha
+	advance fixed.Int26_6
+	ok      bool
+}
+
+type glyphAdvance struct {
+	advance fixed.Int26_6
+	ok      bool
+}
+
+func newCachedFace(face font.Face) *cachedFace {
+	return &cachedFace{
+		face:     face,
+		metrics:  face.Metrics(),
+		glyphs:   make(map[glyphKey]glyph),
+		advances: make(map[rune]glyphAdvance),
+		kerns:    make(map[[2]rune]fixed.Int26_6),
+		outlines: make(map[rune][][]f32.Vec2),
+	}
+}
+
+func (f *cachedFace) Glyph(dot fixed.Point26_6, r rune) (
+	dr image.Rectangle, mask image.Image, maskp image.Point,
+	advance fixed.Int26_6, ok bool) {
+	ix, iy := dot.X.Floor(), dot.Y.Floor()
+	key := glyphKey{
+		r: r,
+		x: (dot.X - fixed.I(ix) + 8) &^ 15,
+		y: dot.Y - fixed.I(iy),
+	}
+	f.mu.RLock()
+	g, cached := f.glyphs[key]
+	f.mu.RUnlock()
+	if !cached {
+		f.mu.Lock()
+		if g, cached = f.glyphs[key]; !cached {
+			g = f.rasterize(key)
+			f.glyphs[key] = g
+		}
+		f.mu.Unlock()
+	}
+	if !g.ok {
+		return image.Rectangle{}, nil, image.Point{}, g.advance, false
+	}
+	return g.dr.Add(image.Pt(ix, iy)), g.mask, g.dr.Min, g.advance, true
+}
+
+// rasterize renders a glyph with the underlying face, copying its mask since
+// faces reuse the memory of their masks. f.mu must be held.
+func (f *cachedFace) rasterize(key glyphKey) glyph {
+	dr, mask, maskp, advance, ok := f.face.Glyph(fixed.Point26_6{X: key.x, Y: key.y}, key.r)
+	if !ok {
+		return glyph{advance: advance}
+	}
+	m := image.NewAlpha(dr)
+	draw.Draw(m, dr, mask, maskp, draw.Src)
+	return glyph{dr: dr, mask: m, advance: advance, ok: true}
+}
+
+func (f *cachedFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.GlyphBounds(r)
+}
+
+func (f *cachedFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	f.mu.RLock()
+	a, cached := f.advances[r]
+	f.mu.RUnlock()
+	if cached {
+		return a.advance, a.ok
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a.advance, a.ok = f.face.GlyphAdvance(r)
+	f.advances[r] = a
+	return a.advance, a.ok
+}
+
+func (f *cachedFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	key := [2]rune{r0, r1}
+	f.mu.RLock()
+	k, cached := f.kerns[key]
+	f.mu.RUnlock()
+	if cached {
+		return k
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	k = f.face.Kern(r0, r1)
+	f.kerns[key] = k
+	return k
+}
+
+func (f *cachedFace) outline(r rune) [][]f32.Vec2 {
+	o, ok := f.face.(outliner)
+	if !ok {
+		return nil
+	}
+	f.mu.RLock()
+	contours, cached := f.outlines[r]
+	f.mu.RUnlock()
+	if cached {
+		return contours
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	contours = o.outline(r)
+	f.outlines[r] = contours
+	return contours
+}
+
+func (f *cachedFace) Metrics() font.Metrics {
+	return f.metrics
+}
+
+// Close does nothing, as cached faces are shared.
+func (f *cachedFace) Close() error {
+	return nil
+}
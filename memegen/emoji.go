@@ -0,0 +1,299 @@
+package memegen
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io/fs"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Emoji is an emoji found in text.
+type Emoji struct {
+	// Text is the emoji as it appears in the text.
+	Text string
+	// ID and Name are the ID and name of a Discord custom emoji. ID is
+	// empty for Unicode emoji.
+	ID, Name string
+	// Animated is true for animated Discord custom emoji.
+	Animated bool
+}
+
+// Codepoints returns the codepoints of a Unicode emoji the way Twemoji names
+// its images, like "1f600" or "1f468-200d-1f469-200d-1f467". Variation
+// selectors are left out unless the emoji is a ZWJ sequence.
+func (e Emoji) Codepoints() string {
+	zwj := strings.ContainsRune(e.Text, '\u200d')
+	var cps []string
+	for _, r := range e.Text {
+		if r == '\ufe0f' && !zwj {
+			continue
+		}
+		cps = append(cps, fmt.Sprintf("%x", r))
+	}
+	return strings.Join(cps, "-")
+}
+
+// EmojiSource finds the images of emoji.
+type EmojiSource interface {
+	// EmojiImage returns the image of e, or nil if it doesn't have one.
+	EmojiImage(e Emoji) (image.Image, error)
+}
+
+// Emojis is where Impact, Caption and templates find the images of emoji in
+// their text. If nil, or if it has no image for an emoji, the emoji is drawn
+// as text. It's BundledEmoji unless it's changed.
+var Emojis EmojiSource = BundledEmoji
+
+//go:embed assets/emoji
+var bundledEmoji embed.FS
+
+// BundledEmoji are the images of Unicode emoji built into memegen, which are
+// Twemoji's, licensed under CC-BY 4.0 (see assets/emoji/LICENSE).
+var BundledEmoji = EmojiFS{FS: mustSub(bundledEmoji, "assets/emoji")}
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// HasBundledEmoji reports whether any images of emoji are built in.
+func HasBundledEmoji() bool {
+	m, _ := fs.Glob(BundledEmoji.FS, "*.png")
+	return len(m) > 0
+}
+
+// EmojiFS is an EmojiSource of images of Unicode emoji laid out like
+// Twemoji's, with PNGs named after their codepoints, like "1f600.png".
+type EmojiFS struct {
+	FS fs.FS
+}
+
+func (e EmojiFS) EmojiImage(em Emoji) (image.Image, error) {
+	if em.ID != "" {
+		return nil, nil
+	}
+	f, err := e.FS.Open(em.Codepoints() + ".png")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+var customEmojiRe = regexp.MustCompile(`^<(a?):(\w+):(\d+)>`)
+
+// segment is a run of text without emoji, or a single emoji.
+type segment struct {
+	text  string
+	emoji *Emoji
+}
+
+// splitEmoji splits s into runs of text and the emoji between them.
+func splitEmoji(s string) []segment {
+	var segs []segment
+	var start int
+	for i := 0; i < len(s); {
+		var e *Emoji
+		n := 0
+		if m := customEmojiRe.FindStringSubmatch(s[i:]); m != nil {
+			e = &Emoji{Text: m[0], Animated: m[1] == "a", Name: m[2], ID: m[3]}
+			n = len(m[0])
+		} else if n = emojiLen(s[i:]); n > 0 {
+			e = &Emoji{Text: s[i : i+n]}
+		}
+		if e == nil {
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+			continue
+		}
+		if start < i {
+			segs = append(segs, segment{text: s[start:i]})
+		}
+		segs = append(segs, segment{text: e.Text, emoji: e})
+		i += n
+		start = i
+	}
+	if start < len(s) {
+		segs = append(segs, segment{text: s[start:]})
+	}
+	return segs
+}
+
+// emojiLen returns the length in bytes of the Unicode emoji at the start of
+// s, or 0 if s doesn't start with one.
+func emojiLen(s string) int {
+	r, n := utf8.DecodeRuneInString(s)
+	next := func() rune {
+		r, _ := utf8.DecodeRuneInString(s[n:])
+		return r
+	}
+	switch {
+	case isRegionalIndicator(r):
+		// flags are pairs of regional indicators
+		if r2, size := utf8.DecodeRuneInString(s[n:]); isRegionalIndicator(r2) {
+			return n + size
+		}
+		return n
+	case isKeycapBase(r):
+		// keycaps are a digit, # or *, optionally a variation selector,
+		// and the combining keycap
+		if next() == '\ufe0f' {
+			n += 3
+		}
+		if next() != '\u20e3' {
+			return 0
+		}
+		return n + 3
+	case isEmojiPresentation(r):
+	case next() == '\ufe0f' && r >= 0xa9:
+	default:
+		return 0
+	}
+	for n < len(s) {
+		r := next()
+		switch {
+		case r == '\ufe0f', r >= 0x1f3fb && r <= 0x1f3ff, r >= 0xe0020 && r <= 0xe007f:
+			// variation selectors, skin tones and the tags of
+			// subdivision flags
+			n += utf8.RuneLen(r)
+		case r == '\u200d':
+			r2, size := utf8.DecodeRuneInString(s[n+3:])
+			if size == 0 || !(isEmojiPresentation(r2) || r2 >= 0x2000) {
+				return n
+			}
+			n += 3 + size
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+func isKeycapBase(r rune) bool {
+	return r >= '0' && r <= '9' || r == '#' || r == '*'
+}
+
+// emojiPresentation are the ranges of characters outside of the emoji blocks
+// which are shown as emoji without a variation selector.
+var emojiPresentation = [][2]rune{
+	{0x231a, 0x231b}, {0x23e9, 0x23ec}, {0x23f0, 0x23f0}, {0x23f3, 0x23f3},
+	{0x25fd, 0x25fe}, {0x2614, 0x2615}, {0x2648, 0x2653}, {0x267f, 0x267f},
+	{0x2693, 0x2693}, {0x26a1, 0x26a1}, {0x26aa, 0x26ab}, {0x26bd, 0x26be},
+	{0x26c4, 0x26c5}, {0x26ce, 0x26ce}, {0x26d4, 0x26d4}, {0x26ea, 0x26ea},
+	{0x26f2, 0x26f3}, {0x26f5, 0x26f5}, {0x26fa, 0x26fa}, {0x26fd, 0x26fd},
+	{0x2705, 0x2705}, {0x270a, 0x270b}, {0x2728, 0x2728}, {0x274c, 0x274c},
+	{0x274e, 0x274e}, {0x2753, 0x2755}, {0x2757, 0x2757}, {0x2795, 0x2797},
+	{0x27b0, 0x27b0}, {0x27bf, 0x27bf}, {0x2b1b, 0x2b1c}, {0x2b50, 0x2b50},
+	{0x2b55, 0x2b55},
+}
+
+// isEmojiPresentation reports whether r is shown as an emoji by default.
+func isEmojiPresentation(r rune) bool {
+	if r >= 0x1f000 && r <= 0x1faff {
+		return !(r >= 0x1f3fb && r <= 0x1f3ff)
+	}
+	for _, rng := range emojiPresentation {
+		if r >= rng[0] && r <= rng[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// emojiImages are the images of the emoji of a layout. Each emoji is looked
+// up in Emojis once, so that laying out text doesn't look emoji up every time
+// it's measured, and it's drawn with the same images it was measured with.
+// Emoji without images, including ones which couldn't be found, are nil.
+type emojiImages map[string]image.Image
+
+// image returns the image of e, or nil if it has none.
+func (m emojiImages) image(e *Emoji) image.Image {
+	if e == nil || Emojis == nil {
+		return nil
+	}
+	img, ok := m[e.Text]
+	if !ok {
+		// emoji whose images can't be found are drawn as text
+		img, _ = Emojis.EmojiImage(*e)
+		if m != nil {
+			m[e.Text] = img
+		}
+	}
+	return img
+}
+
+// emojiText is the text drawn for emoji without images.
+func emojiText(e *Emoji) string {
+	if e.ID != "" {
+		return ":" + e.Name + ":"
+	}
+	return e.Text
+}
+
+// emojiWidth returns the width of img drawn at the height of face.
+func emojiWidth(face font.Face, img image.Image) fixed.Int26_6 {
+	m := face.Metrics()
+	size := img.Bounds().Size()
+	return (m.Ascent + m.Descent) * fixed.Int26_6(size.X) / fixed.Int26_6(size.Y)
+}
+
+// measureString is like dr.MeasureString, but takes emoji into account.
+func measureString(dr *font.Drawer, s string, emojis emojiImages) fixed.Int26_6 {
+	var w fixed.Int26_6
+	for _, seg := range splitEmoji(s) {
+		if seg.emoji == nil {
+			w += dr.MeasureString(seg.text)
+		} else if img := emojis.image(seg.emoji); img != nil {
+			w += emojiWidth(dr.Face, img)
+		} else {
+			w += dr.MeasureString(emojiText(seg.emoji))
+		}
+	}
+	return w
+}
+
+// drawString is like dr.DrawString, but draws the images of emoji at the
+// height of the face. If emoji is false, the space emoji take up is left
+// empty, as when drawing the outline of text.
+func drawString(dr *font.Drawer, s string, emoji bool, emojis emojiImages) {
+	for _, seg := range splitEmoji(s) {
+		if seg.emoji == nil {
+			dr.DrawString(seg.text)
+			continue
+		}
+		img := emojis.image(seg.emoji)
+		if img == nil {
+			dr.DrawString(emojiText(seg.emoji))
+			continue
+		}
+		m := dr.Face.Metrics()
+		w := emojiWidth(dr.Face, img)
+		if emoji {
+			h := (m.Ascent + m.Descent).Round()
+			scaled := imaging.Resize(img, w.Round(), h, imaging.Linear)
+			pt := image.Pt(dr.Dot.X.Round(), (dr.Dot.Y - m.Ascent).Round())
+			draw.Draw(dr.Dst, scaled.Bounds().Add(pt), scaled, image.Point{}, draw.Over)
+		}
+		dr.Dot.X += w
+	}
+}
@@ -0,0 +1,203 @@
+package memegen
+
+import (
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/f32"
+	"golang.org/x/image/math/fixed"
+)
+
+// fontNamed returns the font of a style, one of "impact", "caption" or
+// "times".
+func fontNamed(name string) (*truetype.Font, bool) {
+	switch name {
+	case "impact":
+		return impactFont, true
+	case "caption":
+		return captionFont, true
+	case "times":
+		return timesFont, true
+	}
+	return nil, false
+}
+
+// fallbacks are the fonts tried, in order, for runes missing from the font
+// of each style. The fallbacks under "" are tried for every style, after
+// those of the style itself.
+var fallbacks = make(map[string][]*truetype.Font)
+
+// AddFallbackFont adds f to the end of the fallback chain of a style, or of
+// every style if style is empty. Fallback fonts are meant to be added before
+// anything is rendered, as AddFallbackFont isn't safe to call concurrently
+// with rendering.
+func AddFallbackFont(style string, f *truetype.Font) error {
+	if _, ok := fontNamed(style); style != "" && !ok {
+		return fmt.Errorf("unknown font style %q", style)
+	}
+	fallbacks[style] = append(fallbacks[style], f)
+	clearFaceCache()
+	return nil
+}
+
+// LoadFallbackFont parses the TrueType font file at path and adds it to the
+// fallback chain of a style like AddFallbackFont.
+func LoadFallbackFont(style, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := truetype.Parse(data)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return AddFallbackFont(style, f)
+}
+
+// Variant is a bold and/or italic variant of a font style.
+type Variant int
+
+const (
+	Bold Variant = 1 << iota
+	Italic
+)
+
+type variantKey struct {
+	style   string
+	variant Variant
+}
+
+// variants are the fonts of the variants of each style. Variants without a
+// font are synthesized from the closest font there is.
+var variants = make(map[variantKey]*truetype.Font)
+
+// AddFontVariant sets the font of a variant of a style. Like
+// AddFallbackFont, it's meant to be called before anything is rendered.
+func AddFontVariant(style string, v Variant, f *truetype.Font) error {
+	if _, ok := fontNamed(style); !ok {
+		return fmt.Errorf("unknown font style %q", style)
+	}
+	if v == 0 || v&^(Bold|Italic) != 0 {
+		return fmt.Errorf("invalid font variant %d", v)
+	}
+	variants[variantKey{style, v}] = f
+	clearFaceCache()
+	return nil
+}
+
+// LoadFontVariant parses the TrueType font file at path and sets it as the
+// font of a variant of a style like AddFontVariant.
+func LoadFontVariant(style string, v Variant, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := truetype.Parse(data)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return AddFontVariant(style, v, f)
+}
+
+// variantFont returns the font closest to a variant of a style, along with
+// the parts of the variant it lacks, which have to be synthesized.
+func variantFont(style string, v Variant) (*truetype.Font, Variant) {
+	for _, have := range []Variant{v, v &^ Italic, v &^ Bold} {
+		if f, ok := variants[variantKey{style, have}]; ok && have != 0 {
+			return f, v &^ have
+		}
+	}
+	f, _ := fontNamed(style)
+	return f, v
+}
+
+// makeFace makes a face of a variant of a style at the given size. Runes
+// which the font of the style has no glyph for are drawn with the first of
+// its fallback fonts which has one. Bold and italics are synthesized if the
+// style has no font for them.
+func makeFace(style string, v Variant, size float64) font.Face {
+	f, synth := variantFont(style, v)
+	opts := &truetype.Options{Size: size}
+	var face font.Face = newTTFace(f, opts)
+	var chain []*truetype.Font
+	chain = append(chain, fallbacks[style]...)
+	chain = append(chain, fallbacks[""]...)
+	if len(chain) > 0 {
+		ff := &fallbackFace{
+			fonts: append([]*truetype.Font{f}, chain...),
+			faces: []font.Face{face},
+		}
+		for _, f := range chain {
+			ff.faces = append(ff.faces, newTTFace(f, opts))
+		}
+		face = ff
+	}
+	if synth&Bold != 0 {
+		face = &boldFace{Face: face, strength: max(int(size/24+0.5), 1)}
+	}
+	if synth&Italic != 0 {
+		face = &italicFace{Face: face}
+	}
+	return face
+}
+
+// fallbackFace is a font.Face which draws each rune with the first of its
+// faces whose font has a glyph for it. Its metrics are those of the first
+// face, so that lines are spaced the same no matter which fonts they use.
+type fallbackFace struct {
+	fonts []*truetype.Font
+	faces []font.Face
+}
+
+func (f *fallbackFace) face(r rune) font.Face {
+	for i, fnt := range f.fonts {
+		if fnt.Index(r) != 0 {
+			return f.faces[i]
+		}
+	}
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Close() error {
+	for _, face := range f.faces {
+		face.Close()
+	}
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (
+	dr image.Rectangle, mask image.Image, maskp image.Point,
+	advance fixed.Int26_6, ok bool) {
+	return f.face(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.face(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.face(r).GlyphAdvance(r)
+}
+
+// Kern returns the kerning of two runes if they're drawn with the same face.
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	face := f.face(r0)
+	if face != f.face(r1) {
+		return 0
+	}
+	return face.Kern(r0, r1)
+}
+
+func (f *fallbackFace) outline(r rune) [][]f32.Vec2 {
+	if o, ok := f.face(r).(outliner); ok {
+		return o.outline(r)
+	}
+	return nil
+}
+
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
@@ -0,0 +1,481 @@
+package memegen
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Alignment is how the lines of a Layout are aligned horizontally.
+type Alignment int
+
+const (
+	AlignCenter Alignment = iota
+	AlignLeft
+	AlignRight
+)
+
+// parseAlignment parses "left", "center" or "right". An empty string is
+// centered.
+func parseAlignment(s string) (Alignment, bool) {
+	switch s {
+	case "", "center":
+		return AlignCenter, true
+	case "left":
+		return AlignLeft, true
+	case "right":
+		return AlignRight, true
+	}
+	return 0, false
+}
+
+type LayoutOptions struct {
+	// Width is the width lines are wrapped to. If it's zero, lines are only
+	// broken at newlines.
+	Width int
+	Align Alignment
+	// LineSpacing is the distance from the top of one line to the top of
+	// the next, as a multiple of the height of the face. If zero, 1 is used.
+	LineSpacing float64
+	// Balance makes the lines of each paragraph as close to the same width
+	// as possible, instead of filling each line before starting the next.
+	Balance bool
+}
+
+// Layout is text broken into lines and positioned for drawing.
+type Layout struct {
+	Lines []Line
+	// Width is the width the lines are aligned within, and Height is the
+	// height from the top of the first line to the bottom of the last.
+	Width, Height int
+	face          font.Face
+	emojis        emojiImages
+}
+
+// Line is a line of a Layout.
+type Line struct {
+	// Text is the text of the line in the order it's drawn in, from left to
+	// right.
+	Text string
+	// Runs are the runs of text of the line in one style, in the order
+	// they're drawn in.
+	Runs []Run
+	// Box is where the line is drawn, relative to the top left of the
+	// layout. Its height is the height of the face, grown to fit larger
+	// text, and the baseline is the largest ascent of its faces below its
+	// top.
+	Box image.Rectangle
+	// RTL is true for lines of right-to-left paragraphs, which are
+	// right-aligned with the other lines of their paragraph.
+	RTL bool
+	// Broken is true if the line ends partway through a word that was too
+	// wide to fit on one line.
+	Broken bool
+
+	faces  []font.Face
+	ascent fixed.Int26_6
+}
+
+// LayoutText breaks text into lines drawn with face, according to opts.
+// Each line of text is a paragraph, which is wrapped at spaces, and within
+// words which are wider than opts.Width. Arabic letters are shaped, and
+// the characters of right-to-left text are reordered for drawing.
+func LayoutText(face font.Face, text string, opts LayoutOptions) *Layout {
+	faces := func(Style) font.Face { return face }
+	return layoutRuns(faces, []Run{{Text: text}}, opts)
+}
+
+// LayoutMarkup is like LayoutText, but text is marked up as described by
+// ParseMarkup, and drawn in the fonts of a style at the given size.
+func LayoutMarkup(style string, size float64, text string, opts LayoutOptions) *Layout {
+	faces := func(s Style) font.Face {
+		return newVariantFace(style, s.Variant, size*s.scale())
+	}
+	return layoutRuns(faces, ParseMarkup(text), opts)
+}
+
+// para is a paragraph of text along with the style of each of its bytes, as
+// an index into the styles of its layout.
+type para struct {
+	text  string
+	style []int
+}
+
+func (p para) slice(i, j int) para {
+	return para{p.text[i:j], p.style[i:j]}
+}
+
+func (p para) append(text string, style int) para {
+	styles := make([]int, len(p.style), len(p.style)+len(text))
+	copy(styles, p.style)
+	for i := 0; i < len(text); i++ {
+		styles = append(styles, style)
+	}
+	return para{p.text + text, styles}
+}
+
+// runs calls fn with each run of p in one style.
+func (p para) runs(fn func(text string, style int)) {
+	for i := 0; i < len(p.text); {
+		j := i + 1
+		for j < len(p.text) && p.style[j] == p.style[i] {
+			j++
+		}
+		fn(p.text[i:j], p.style[i])
+		i = j
+	}
+}
+
+// layouter lays out text in a set of styles.
+type layouter struct {
+	styles []Style
+	faces  []font.Face
+	emojis emojiImages
+	dr     font.Drawer
+}
+
+func (l *layouter) measure(p para) fixed.Int26_6 {
+	var w fixed.Int26_6
+	p.runs(func(text string, style int) {
+		l.dr.Face = l.faces[style]
+		w += measureString(&l.dr, text, l.emojis)
+	})
+	return w
+}
+
+func layoutRuns(faces func(Style) font.Face, runs []Run, opts LayoutOptions) *Layout {
+	lt := &layouter{styles: []Style{{}}, faces: []font.Face{faces(Style{})},
+		emojis: make(emojiImages)}
+	l := &Layout{Width: opts.Width, face: lt.faces[0], emojis: lt.emojis}
+	var whole para
+	for _, run := range runs {
+		i := 0
+		for ; i < len(lt.styles) && lt.styles[i] != run.Style; i++ {
+		}
+		if i == len(lt.styles) {
+			lt.styles = append(lt.styles, run.Style)
+			lt.faces = append(lt.faces, faces(run.Style))
+		}
+		whole = whole.append(run.Text, i)
+	}
+	trimmed := strings.TrimSpace(whole.text)
+	if trimmed == "" {
+		return l
+	}
+	start := len(whole.text) - len(strings.TrimLeftFunc(whole.text, unicode.IsSpace))
+	whole = whole.slice(start, start+len(trimmed))
+
+	width := fixed.Int26_6(1<<31 - 1)
+	if opts.Width > 0 {
+		width = fixed.I(opts.Width)
+	}
+
+	type placed struct {
+		text         para
+		width, block fixed.Int26_6
+		rtl, broken  bool
+	}
+	var lines []placed
+	var widest fixed.Int26_6
+	for i := 0; i <= len(whole.text); {
+		end := strings.IndexByte(whole.text[i:], '\n')
+		if end < 0 {
+			end = len(whole.text)
+		} else {
+			end += i
+		}
+		p := whole.slice(i, end)
+		i = end + 1
+		trimmed := strings.TrimSpace(p.text)
+		start := len(p.text) - len(strings.TrimLeftFunc(p.text, unicode.IsSpace))
+		p = p.slice(start, start+len(trimmed))
+
+		var shaped para
+		p.runs(func(text string, style int) {
+			shaped = shaped.append(shapeArabic(text), style)
+		})
+		rtl := isRTL(p.text)
+		var block fixed.Int26_6
+		first := len(lines)
+		for _, bl := range lt.breakParagraph(shaped, width, opts.Balance) {
+			var vis para
+			for _, c := range visualClusters(bl.text.text, rtl) {
+				vis = vis.append(c.text, bl.text.style[c.pos])
+			}
+			w := lt.measure(vis)
+			block = max(block, w)
+			lines = append(lines, placed{text: vis, width: w, rtl: rtl, broken: bl.broken})
+		}
+		for i := first; i < len(lines); i++ {
+			lines[i].block = block
+		}
+		widest = max(widest, block)
+	}
+	if opts.Width <= 0 {
+		width = widest
+		l.Width = widest.Ceil()
+	}
+
+	m := lt.faces[0].Metrics()
+	faceh := m.Height.Ceil()
+	spacing := opts.LineSpacing
+	if spacing == 0 {
+		spacing = 1
+	}
+	pad := int(float64(faceh) * (spacing - 1))
+	var y int
+	for _, p := range lines {
+		// paragraphs are placed according to the alignment, and the lines
+		// of right-to-left paragraphs are right-aligned within them
+		var x fixed.Int26_6
+		switch opts.Align {
+		case AlignLeft:
+		case AlignRight:
+			x = width - p.block
+		default:
+			x = (width - p.block) / 2
+		}
+		switch {
+		case p.rtl || opts.Align == AlignRight:
+			x += p.block - p.width
+		case opts.Align == AlignCenter:
+			x += (p.block - p.width) / 2
+		}
+		line := Line{RTL: p.rtl, Broken: p.broken, ascent: m.Ascent}
+		// lines with larger text are made taller to fit it
+		descent := m.Descent
+		p.text.runs(func(text string, style int) {
+			face := lt.faces[style]
+			line.Text += text
+			line.Runs = append(line.Runs, Run{Text: text, Style: lt.styles[style]})
+			line.faces = append(line.faces, face)
+			line.ascent = max(line.ascent, face.Metrics().Ascent)
+			descent = max(descent, face.Metrics().Descent)
+		})
+		lineh := faceh + (line.ascent - m.Ascent + descent - m.Descent).Ceil()
+		line.Box = image.Rect(x.Round(), y, (x + p.width).Round(), y+lineh)
+		l.Lines = append(l.Lines, line)
+		y += lineh + pad
+	}
+	l.Height = y - pad
+	return l
+}
+
+// Draw draws the layout in src with its top left corner at pt. Runs with a
+// colour of their own are drawn in it instead. If emoji is false, as when
+// drawing the outline of text, the space emoji take up is left empty and
+// every run is drawn in src.
+func (l *Layout) Draw(dst draw.Image, pt image.Point, src image.Image, emoji bool) {
+	dr := &font.Drawer{Dst: dst}
+	for _, line := range l.Lines {
+		r := line.Box.Add(pt)
+		dr.Dot = fixed.Point26_6{X: fixed.I(r.Min.X), Y: fixed.I(r.Min.Y) + line.ascent}
+		for i, run := range line.Runs {
+			dr.Face = line.faces[i]
+			dr.Src = src
+			if run.Style.Color != nil && emoji {
+				dr.Src = image.NewUniform(run.Style.Color)
+			}
+			x := dr.Dot.X
+			drawString(dr, run.Text, emoji, l.emojis)
+			if run.Style.Underline {
+				drawUnderline(dr, x)
+			}
+		}
+	}
+}
+
+// drawUnderline underlines text drawn with dr from x to the dot.
+func drawUnderline(dr *font.Drawer, x fixed.Int26_6) {
+	m := dr.Face.Metrics()
+	thickness := max(m.Height.Ceil()/16, 1)
+	y := (dr.Dot.Y + m.Descent/3).Round()
+	r := image.Rect(x.Round(), y, dr.Dot.X.Round(), y+thickness)
+	draw.Draw(dr.Dst, r, dr.Src, image.Point{}, draw.Over)
+}
+
+// minFontSize is the smallest size fitLayout shrinks text to.
+const minFontSize = 6
+
+// fitLayout lays text out with layout at the largest size up to maxSize it
+// fits into maxH pixels of height at without breaking words, found by binary
+// search. If it doesn't fit at the smallest size, it's laid out at that size
+// anyway.
+func fitLayout(maxSize float64, maxH int, layout func(size float64) *Layout) *Layout {
+	fits := func(l *Layout) bool {
+		return l.Height <= maxH && !l.broken()
+	}
+	l := layout(maxSize)
+	if fits(l) || maxSize <= minFontSize {
+		return l
+	}
+	// sizes are searched in whole pixels, lo always being a size the text
+	// fits at unless it's the smallest
+	lo, hi := minFontSize, int(math.Ceil(maxSize))-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if fits(layout(float64(mid))) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return layout(float64(lo))
+}
+
+// plainText returns a function which lays text out in a style at a given
+// size, for fitLayout.
+func plainText(style, text string, opts LayoutOptions) func(float64) *Layout {
+	return func(size float64) *Layout {
+		return LayoutText(newFace(style, size), text, opts)
+	}
+}
+
+// markupText is like plainText, but for text with markup.
+func markupText(style, text string, opts LayoutOptions) func(float64) *Layout {
+	return func(size float64) *Layout {
+		return LayoutMarkup(style, size, text, opts)
+	}
+}
+
+// broken reports whether any word of the layout was broken across lines.
+func (l *Layout) broken() bool {
+	for _, line := range l.Lines {
+		if line.Broken {
+			return true
+		}
+	}
+	return false
+}
+
+// word is the range of a word in a paragraph.
+type word struct {
+	start, end int
+}
+
+// brokenLine is a line of a paragraph in logical order.
+type brokenLine struct {
+	text   para
+	broken bool
+}
+
+// breakParagraph breaks a paragraph into lines no wider than width.
+func (lt *layouter) breakParagraph(p para, width fixed.Int26_6, balance bool) []brokenLine {
+	var words []word
+	var pos int
+	for i, field := range splitOnSpace(p.text) {
+		if i%2 == 0 {
+			words = append(words, word{pos, pos + len(field)})
+		}
+		pos += len(field)
+	}
+	lines := lt.breakGreedy(p, words, width)
+	if !balance || len(lines) < 2 {
+		return lines
+	}
+	// the narrowest width which doesn't take more lines is found, without
+	// going below the width of the widest word so that balancing never
+	// breaks words which would otherwise fit
+	var lo int
+	for _, w := range words {
+		lo = max(lo, min(lt.measure(p.slice(w.start, w.end)), width).Ceil())
+	}
+	hi := width.Ceil()
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if len(lt.breakGreedy(p, words, fixed.I(mid))) <= len(lines) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lt.breakGreedy(p, words, min(fixed.I(lo), width))
+}
+
+// breakGreedy breaks the words of a paragraph into lines, putting as many
+// words on each line as fit.
+func (lt *layouter) breakGreedy(p para, words []word, width fixed.Int26_6) []brokenLine {
+	var lines []brokenLine
+	var cur para
+	var start int
+	for i, w := range words {
+		if i > 0 {
+			if next := p.slice(start, w.end); lt.measure(next) <= width {
+				cur = next
+				continue
+			}
+			lines = append(lines, brokenLine{text: cur})
+		}
+		pieces := lt.breakWord(p.slice(w.start, w.end), width)
+		for _, piece := range pieces[:len(pieces)-1] {
+			lines = append(lines, brokenLine{text: piece, broken: true})
+		}
+		cur = pieces[len(pieces)-1]
+		start = w.end - len(cur.text)
+	}
+	return append(lines, brokenLine{text: cur})
+}
+
+// breakWord breaks a word wider than width into pieces which fit, keeping
+// emoji and characters with their marks together. Pieces which end between
+// two letters of an alphabet are hyphenated. The last piece is always a
+// part of the word, without a hyphen.
+func (lt *layouter) breakWord(w para, width fixed.Int26_6) []para {
+	if lt.measure(w) <= width {
+		return []para{w}
+	}
+	cs := clusters(w.text)
+	var pieces []para
+	start := 0
+	for i, c := range cs {
+		end := c.pos + len(c.text)
+		next := w.slice(start, end)
+		// room is left for a hyphen in case the word is broken after c
+		if i+1 < len(cs) && hyphenates(c.text, cs[i+1].text) {
+			next = next.append("-", w.style[end-1])
+		}
+		if c.pos > start && lt.measure(next) > width {
+			piece := w.slice(start, c.pos)
+			if hyphenates(piece.text, c.text) {
+				piece = piece.append("-", w.style[c.pos-1])
+			}
+			pieces = append(pieces, piece)
+			start = c.pos
+		}
+	}
+	return append(pieces, w.slice(start, len(w.text)))
+}
+
+// hyphenates reports whether a hyphen is added when a word is broken between
+// before and after.
+func hyphenates(before, after string) bool {
+	a, _ := utf8.DecodeLastRuneInString(before)
+	b := firstRune(after)
+	return isAlphabetic(a) && isAlphabetic(b)
+}
+
+func isAlphabetic(r rune) bool {
+	return unicode.In(r, unicode.Latin, unicode.Cyrillic, unicode.Greek)
+}
+
+func splitOnSpace(x string) []string {
+	var result []string
+	pi := 0
+	ps := false
+	for i, c := range x {
+		s := unicode.IsSpace(c)
+		if s != ps && i > 0 {
+			result = append(result, x[pi:i])
+			pi = i
+		}
+		ps = s
+	}
+	result = append(result, x[pi:])
+	return result
+}
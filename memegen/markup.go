@@ -0,0 +1,252 @@
+package memegen
+
+import (
+	"image/color"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Style is how a run of text is drawn.
+type Style struct {
+	Variant   Variant
+	Underline bool
+	// Color is the colour of the text. If nil, the text is drawn in the
+	// colour the rest of it is.
+	Color color.Color
+	// Scale is the size of the text relative to the rest of it. Zero means
+	// 1. It's kept between minTextScale and maxTextScale.
+	Scale float64
+}
+
+// The smallest and largest Scale text can be drawn at, so that nesting size
+// tags can't make text unreadable or too big to draw.
+const (
+	minTextScale = 0.5
+	maxTextScale = 2
+)
+
+func (s Style) scale() float64 {
+	if s.Scale == 0 {
+		return 1
+	}
+	return min(max(s.Scale, minTextScale), maxTextScale)
+}
+
+// Run is a run of text in one style.
+type Run struct {
+	Text  string
+	Style Style
+}
+
+// markupColors are the colours which can be used by name in markup.
+var markupColors = map[string]color.Color{
+	"red":    color.NRGBA{0xe5, 0x1c, 0x23, 0xff},
+	"orange": color.NRGBA{0xff, 0x98, 0x00, 0xff},
+	"yellow": color.NRGBA{0xff, 0xeb, 0x3b, 0xff},
+	"green":  color.NRGBA{0x25, 0x9b, 0x24, 0xff},
+	"blue":   color.NRGBA{0x1e, 0x88, 0xe5, 0xff},
+	"purple": color.NRGBA{0x8e, 0x24, 0xaa, 0xff},
+	"pink":   color.NRGBA{0xf0, 0x62, 0x92, 0xff},
+	"white":  color.NRGBA{0xff, 0xff, 0xff, 0xff},
+	"black":  color.NRGBA{0x00, 0x00, 0x00, 0xff},
+	"gray":   color.NRGBA{0x80, 0x80, 0x80, 0xff},
+	"grey":   color.NRGBA{0x80, 0x80, 0x80, 0xff},
+}
+
+// colorNamed parses a colour which is either named in markupColors or in hex
+// RGB.
+func colorNamed(s string) (color.Color, error) {
+	if c, ok := markupColors[s]; ok {
+		return c, nil
+	}
+	return parseColor(s)
+}
+
+// markupTag returns how the tag {name} changes the style of the text in it,
+// or nil if there's no such tag.
+func markupTag(name string) func(*Style) {
+	switch name {
+	case "big":
+		return func(s *Style) { s.Scale = min(s.scale()*1.25, maxTextScale) }
+	case "small":
+		return func(s *Style) { s.Scale = max(s.scale()*0.8, minTextScale) }
+	}
+	c, ok := markupColors[name]
+	if !ok && strings.HasPrefix(name, "#") {
+		var err error
+		c, err = parseColor(name)
+		ok = err == nil
+	}
+	if !ok {
+		return nil
+	}
+	return func(s *Style) { s.Color = c }
+}
+
+type markupToken struct {
+	text string
+	// marker is "**", "*" or "__" for markers which toggle a style, "{" for
+	// tags and "{/" for closing tags, or empty for text
+	marker     string
+	tag        func(*Style)
+	start, end int
+	// paired is true for markers which open or close a span
+	paired bool
+}
+
+// ParseMarkup splits text marked up with **bold**, *italic*, __underline__,
+// {red}colours{/} (by name or like {#ff0000}) and {big}/{small} sizes into
+// runs of text in one style. Markers which don't open or close a span are
+// left as they are, as are markers escaped with a backslash. Backslashes
+// before anything other than a marker which would open or close a span are
+// left alone, so that text like ¯\_(ツ)_/¯ is unchanged.
+func ParseMarkup(s string) []Run {
+	paired := make(map[int]bool)
+	for _, t := range pairMarkup(s, tokenizeMarkup(s, nil)) {
+		if t.paired {
+			paired[t.start] = true
+		}
+	}
+	tokens := pairMarkup(s, tokenizeMarkup(s, paired))
+
+	var runs []Run
+	var bold, italic, underline bool
+	var tags []func(*Style)
+	for _, t := range tokens {
+		if t.marker == "" || !t.paired {
+			var style Style
+			if bold {
+				style.Variant |= Bold
+			}
+			if italic {
+				style.Variant |= Italic
+			}
+			style.Underline = underline
+			for _, tag := range tags {
+				tag(&style)
+			}
+			if n := len(runs); n > 0 && runs[n-1].Style == style {
+				runs[n-1].Text += t.text
+			} else {
+				runs = append(runs, Run{Text: t.text, Style: style})
+			}
+			continue
+		}
+		switch t.marker {
+		case "**":
+			bold = !bold
+		case "*":
+			italic = !italic
+		case "__":
+			underline = !underline
+		case "{":
+			tags = append(tags, t.tag)
+		case "{/":
+			tags = tags[:len(tags)-1]
+		}
+	}
+	return runs
+}
+
+// tokenizeMarkup splits s into text and markers. Backslashes only escape
+// what follows them if they're before a marker starting at an index in
+// escapes.
+func tokenizeMarkup(s string, escapes map[int]bool) []markupToken {
+	var tokens []markupToken
+	var text strings.Builder
+	textStart := 0
+	flush := func(i int) {
+		if text.Len() > 0 {
+			tokens = append(tokens, markupToken{text: text.String(), start: textStart, end: i})
+			text.Reset()
+		}
+	}
+	for i := 0; i < len(s); {
+		var marker, raw string
+		var tag func(*Style)
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`\*_{}`, s[i+1]) >= 0 &&
+			escapes[len(s)-len(strings.TrimLeft(s[i:], `\`))]:
+			if text.Len() == 0 {
+				textStart = i
+			}
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+		case s[i] == '<':
+			// custom emoji are left alone, as their names can have
+			// underscores
+			if m := customEmojiRe.FindString(s[i:]); m != "" {
+				if text.Len() == 0 {
+					textStart = i
+				}
+				text.WriteString(m)
+				i += len(m)
+				continue
+			}
+		case strings.HasPrefix(s[i:], "**"), strings.HasPrefix(s[i:], "__"):
+			marker, raw = s[i:i+2], s[i:i+2]
+		case s[i] == '*':
+			marker, raw = "*", "*"
+		case strings.HasPrefix(s[i:], "{/}"):
+			marker, raw = "{/", "{/}"
+		case s[i] == '{':
+			if end := strings.IndexByte(s[i:], '}'); end > 0 {
+				if tag = markupTag(s[i+1 : i+end]); tag != nil {
+					marker, raw = "{", s[i:i+end+1]
+				}
+			}
+		}
+		if marker == "" {
+			if text.Len() == 0 {
+				textStart = i
+			}
+			_, size := utf8.DecodeRuneInString(s[i:])
+			text.WriteString(s[i : i+size])
+			i += size
+			continue
+		}
+		flush(i)
+		tokens = append(tokens, markupToken{text: raw, marker: marker, tag: tag,
+			start: i, end: i + len(raw)})
+		i += len(raw)
+	}
+	flush(len(s))
+	return tokens
+}
+
+// pairMarkup marks the markers of tokens which open or close a span.
+func pairMarkup(s string, tokens []markupToken) []markupToken {
+	// toggling markers open spans when followed by something other than
+	// space, and close them when preceded by something other than space
+	isSpace := func(r rune) bool { return r == utf8.RuneError || unicode.IsSpace(r) }
+	for _, marker := range []string{"**", "*", "__"} {
+		open := -1
+		for i, t := range tokens {
+			if t.marker != marker {
+				continue
+			}
+			before, _ := utf8.DecodeLastRuneInString(s[:t.start])
+			after, _ := utf8.DecodeRuneInString(s[t.end:])
+			if open >= 0 && !isSpace(before) {
+				tokens[open].paired, tokens[i].paired = true, true
+				open = -1
+			} else if !isSpace(after) {
+				open = i
+			}
+		}
+	}
+	depth := 0
+	for i, t := range tokens {
+		switch {
+		case t.marker == "{":
+			tokens[i].paired = true
+			depth++
+		case t.marker == "{/" && depth > 0:
+			tokens[i].paired = true
+			depth--
+		}
+	}
+	return tokens
+}
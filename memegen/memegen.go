@@ -1,263 +1,281 @@
 package memegen
 
 import (
-	_ "embed"
+	"embed"
+	"errors"
+	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
+	"io/fs"
+	"strconv"
 	"strings"
-	"unicode"
 
 	"github.com/golang/freetype/truetype"
-	"samhza.com/gg"
-	"golang.org/x/image/font"
-	"golang.org/x/image/math/fixed"
 )
 
 var impactFont, captionFont, timesFont *truetype.Font
 
-//go:embed assets/impact.ttf
-var impactTTF []byte
+// fontFiles are the fonts of each style, as assets/<style>.ttf, and of their
+// variants, as assets/<style>-bold.ttf, -italic.ttf and -bolditalic.ttf.
+//
+//go:embed assets/*.ttf
+var fontFiles embed.FS
 
-//go:embed assets/caption.ttf
-var captionTTF []byte
+// fontVariantNames are the suffixes of the files of the variants in
+// fontFiles.
+var fontVariantNames = map[Variant]string{
+	Bold:          "bold",
+	Italic:        "italic",
+	Bold | Italic: "bolditalic",
+}
 
-//go:embed assets/times.ttf
-var timesTTF []byte
+func parseFontFile(name string) (*truetype.Font, error) {
+	data, err := fontFiles.ReadFile("assets/" + name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := truetype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return f, nil
+}
 
 func init() {
 	var err error
-	if impactFont, err = truetype.Parse(impactTTF); err != nil {
+	if impactFont, err = parseFontFile("impact.ttf"); err != nil {
 		panic(err)
 	}
-	if captionFont, err = truetype.Parse(captionTTF); err != nil {
+	if captionFont, err = parseFontFile("caption.ttf"); err != nil {
 		panic(err)
 	}
-	if timesFont, err = truetype.Parse(timesTTF); err != nil {
+	if timesFont, err = parseFontFile("times.ttf"); err != nil {
 		panic(err)
 	}
+	// variants without a file are synthesized
+	for _, style := range []string{"impact", "caption", "times"} {
+		for v, suffix := range fontVariantNames {
+			f, err := parseFontFile(style + "-" + suffix + ".ttf")
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err == nil {
+				err = AddFontVariant(style, v, f)
+			}
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
 }
 
+// The largest fraction of the height of the image a block of text can take up
+// in each kind of meme. Text which is too tall is drawn at the largest size
+// it fits at.
+var (
+	ImpactTextHeight   = 0.4
+	CaptionTextHeight  = 0.5
+	MotivateTextHeight = 0.5
+)
+
+// ImpactOutline is how the text of Impact memes is outlined, for an image
+// 1000 pixels high. It's scaled to the height of the image.
+var ImpactOutline = Outline{Width: 8, Color: color.Black, Join: JoinRound}
+
 func Impact(m draw.Image, top, bot string) {
 	b := m.Bounds()
 	w, h := b.Max.X-b.Min.X, b.Max.Y-b.Min.Y
-	face := truetype.NewFace(impactFont, &truetype.Options{Size: float64(h / 8)})
-	dr := &font.Drawer{
-		Face: face,
-		Dst:  m,
-	}
-	var text []string
-	var y int
-	fn := func(xoff, yoff int) {
-		drawStringsCentered(dr, w, xoff, y+yoff, 0, text)
-	}
-	n := h / 160
-	draw := func() {
-		dr.Src = image.Black
-		fn(-n, -n)
-		fn(-n, +n)
-		fn(n, -n)
-		fn(n, n)
-		dr.Src = image.White
-		fn(0, 0)
+	opts := LayoutOptions{Width: w, Balance: true}
+	maxH := int(float64(h) * ImpactTextHeight)
+	outline := ImpactOutline
+	scale := float64(h) / 1000
+	outline.Width *= scale
+	outline.ShadowOffset = image.Pt(int(float64(outline.ShadowOffset.X)*scale),
+		int(float64(outline.ShadowOffset.Y)*scale))
+	outline.ShadowBlur *= scale
+	draw := func(l *Layout, y int) {
+		l.DrawOutlined(m, b.Min.Add(image.Pt(0, y)), image.White, outline)
 	}
 
-	text = wrap(dr, w, top)
-	y = h / 32
-	draw()
-
-	text = wrap(dr, w, bot)
-	_, texth := measure(dr, text)
-	y = h - texth - h/32
-	draw()
+	draw(fitLayout(float64(h/8), maxH, plainText("impact", top, opts)), h/32)
+	botL := fitLayout(float64(h/8), maxH, plainText("impact", bot, opts))
+	draw(botL, h-botL.Height-h/32)
 }
 
-func measure(dr *font.Drawer, lines []string) (w, h int) {
-	var fixw fixed.Int26_6
-	faceh := dr.Face.Metrics().Height.Ceil()
-	for _, line := range lines {
-		fixw += dr.MeasureString(line)
-		h += faceh
-	}
-	w = fixw.Ceil()
-	return
+// TitleCard makes a w by h black image with text centered on it in white.
+func TitleCard(w, h int, text string) image.Image {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(m, m.Bounds(), image.Black, image.Point{}, draw.Src)
+	face := newFace("impact", float64(h/8))
+	l := LayoutText(face, text, LayoutOptions{Width: w * 9 / 10, Balance: true})
+	l.Draw(m, image.Pt((w-l.Width)/2, (h-l.Height)/2), image.White, true)
+	return m
 }
 
-func drawStringsCentered(dr *font.Drawer, w, x, y, pad int, lines []string) {
-	faceh := dr.Face.Metrics().Height.Ceil()
-	for _, str := range lines {
-		drawStringCentered(dr, w, x, y, str)
-		y += faceh + pad
+// Caption makes an iFunny-like caption meant to have another image overlayed
+// onto it.
+// The returned image and point are meant to be used as dest and sp for a
+// call to draw.Draw with draw.Over as the op.
+func Caption(w, h int, text string) (image.Image, image.Point) {
+	opts := LayoutOptions{Width: w, LineSpacing: 1.2}
+
+	l := fitLayout(float64(w)/10, int(float64(h)*CaptionTextHeight),
+		markupText("caption", text, opts))
+	padding := l.face.Metrics().Height.Ceil() / 2
+	rectH := l.Height + padding*2
+	if rectH%2 != 0 {
+		rectH++
 	}
+
+	m := image.NewRGBA(image.Rect(0, 0, w, rectH+h))
+	draw.Draw(m, image.Rect(0, 0, w, rectH), image.White, image.Point{}, draw.Src)
+	l.Draw(m, image.Pt(0, (rectH-l.Height)/2), image.Black, true)
+
+	return m, image.Point{0, -rectH}
 }
 
-func drawStringCentered(dr *font.Drawer, w, x, y int, str string) {
-	dr.Dot = fixed.Point26_6{(fixed.I(w)-dr.MeasureString(str))/2 + fixed.I(x), dr.Face.Metrics().Height + fixed.I(y)}
-	dr.DrawString(str)
+// MotivateOptions are how a motivational meme looks. The zero value is the
+// classic one: white Times text on black, with a thin white border around the
+// image.
+type MotivateOptions struct {
+	// Background is the colour of the poster. It defaults to black.
+	Background color.Color
+	// Border is the colour of the border around the image. It defaults to
+	// white.
+	Border color.Color
+	// BorderWidth is the width of the border in pixels. If nil, it's 2.
+	BorderWidth *int
+	// Color is the colour of the text. It defaults to white.
+	Color color.Color
+	// TopFont and BottomFont are the fonts of the title and subtitle, one
+	// of "impact", "caption" or "times". They default to "times".
+	TopFont, BottomFont string
+	// BottomSize is how big the subtitle is relative to the title. It
+	// defaults to 0.8.
+	BottomSize float64
+	// Times is how many posters the image is framed in, each one around
+	// the last. It defaults to 1. Posters which would be larger than
+	// MaxMotivateSize are left out.
+	Times int
 }
 
-func wrap(dr *font.Drawer, width int, str string) []string {
-	var result []string
-	for _, line := range strings.Split(str, "\n") {
-		fields := splitOnSpace(line)
-		if len(fields)%2 == 1 {
-			fields = append(fields, "")
+// MaxMotivateSize is the most pixels along either side a nested motivational
+// meme can be. The poster around the image itself is always made.
+var MaxMotivateSize = 4096
+
+// ErrUnknownOption is returned by MotivateOptions.Set for options which don't
+// exist.
+var ErrUnknownOption = errors.New("unknown option")
+
+// Set sets the option named key, as it's named in commands, to value.
+func (o *MotivateOptions) Set(key, value string) error {
+	var err error
+	switch key {
+	case "bg", "background":
+		o.Background, err = colorNamed(value)
+	case "border":
+		o.Border, err = colorNamed(value)
+	case "color", "colour":
+		o.Color, err = colorNamed(value)
+	case "border-width":
+		var n int
+		if n, err = strconv.Atoi(value); err == nil && n < 0 {
+			return errors.New("border width can't be negative")
 		}
-		x := ""
-		for i := 0; i < len(fields); i += 2 {
-			w := dr.MeasureString(x + fields[i])
-			if w.Ceil() > width {
-				if x == "" {
-					result = append(result, fields[i])
-					x = ""
-					continue
-				} else {
-					result = append(result, x)
-					x = ""
-				}
-			}
-			x += fields[i] + fields[i+1]
+		o.BorderWidth = &n
+	case "font", "top-font", "bottom-font":
+		if _, ok := fontNamed(value); !ok {
+			return fmt.Errorf("unknown font %q", value)
 		}
-		if x != "" {
-			result = append(result, x)
+		if key != "bottom-font" {
+			o.TopFont = value
 		}
+		if key != "top-font" {
+			o.BottomFont = value
+		}
+	case "bottom-size":
+		o.BottomSize, err = strconv.ParseFloat(value, 64)
+		if err == nil && (o.BottomSize < 0.25 || o.BottomSize > 2) {
+			err = errors.New("bottom size must be between 0.25 and 2")
+		}
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownOption, key)
 	}
-	for i, line := range result {
-		result[i] = strings.TrimSpace(line)
-	}
-	return result
+	return err
 }
 
-func splitOnSpace(x string) []string {
-	var result []string
-	pi := 0
-	ps := false
-	for i, c := range x {
-		s := unicode.IsSpace(c)
-		if s != ps && i > 0 {
-			result = append(result, x[pi:i])
-			pi = i
-		}
-		ps = s
+func orColor(c, def color.Color) image.Image {
+	if c == nil {
+		c = def
 	}
-	result = append(result, x[pi:])
-	return result
+	return image.NewUniform(c)
 }
 
-// Caption makes an iFunny-like caption meant to have another image overlayed
-// onto it.
-// The returned image and point are meant to be used as dest and sp for a
-// call to draw.Draw with draw.Over as the op.
-func Caption(w, h int, text string) (image.Image, image.Point) {
-	linespc := 1.2
-
-	dc := gg.NewContext(0, 0)
-	face := truetype.NewFace(captionFont, &truetype.Options{Size: float64(w) / 10})
-	dc.SetFontFace(face)
-	sizedFace, textH := limitWrappedTextHeight(dc, captionFont, text, float64(w), float64(h)/2, 1.0)
-	if sizedFace != nil {
-		face = sizedFace
+func orFont(name string) string {
+	if name == "" {
+		return "times"
 	}
-	padding := dc.FontHeight() / 2
-	rectH := textH + padding*2
-	if int(rectH)%2 != 0 {
-		rectH = rectH + 1.0
-	}
-
-	dc = gg.NewContext(w, int(rectH)+h)
-	dc.SetFontFace(face)
-	dc.SetRGB(1, 1, 1)
-	dc.DrawRectangle(0, 0, float64(w), rectH)
-	dc.Fill()
-	dc.SetRGB(0, 0, 0)
-	dc.DrawStringWrapped(text, float64(w)/2,
-		rectH/2,
-		0.5, 0.5,
-		float64(w), linespc, gg.AlignCenter)
-
-	return dc.Image(), image.Point{0, -int(rectH)}
+	return name
 }
 
 // Motivate makes a "motivational meme" frame meant to have another image overlayed onto it.
 // The returned image and point are meant to be used as dest and sp for a
 // call to draw.Draw with draw.Over as the op.
-func Motivate(w, h int, top, bot string) (image.Image, image.Point) {
+func Motivate(w, h int, top, bot string, o MotivateOptions) (image.Image, image.Point) {
+	m, pt := motivate(w, h, top, bot, o)
+	for i := 1; i < o.Times; i++ {
+		outer, outerPt := motivate(m.Bounds().Dx(), m.Bounds().Dy(), top, bot, o)
+		if size := outer.Bounds().Size(); max(size.X, size.Y) > MaxMotivateSize {
+			break
+		}
+		draw.Draw(outer, m.Bounds().Sub(outerPt), m, image.Point{}, draw.Src)
+		m, pt = outer, pt.Add(outerPt)
+	}
+	return m, pt
+}
+
+func motivate(w, h int, top, bot string, o MotivateOptions) (*image.RGBA, image.Point) {
 	padding := int(float64(h) / 10)
-	linespc := 1.2
-	topFace := truetype.NewFace(timesFont, &truetype.Options{Size: float64(h / 8)})
-	botFace := truetype.NewFace(timesFont, &truetype.Options{Size: float64(h / 10)})
+	borderW := 2
+	if o.BorderWidth != nil {
+		borderW = *o.BorderWidth
+	}
+	borderW = min(borderW, padding)
+	bottomSize := o.BottomSize
+	if bottomSize == 0 {
+		bottomSize = 0.8
+	}
+	opts := LayoutOptions{Width: w, LineSpacing: 1.2}
+	maxH := int(float64(h) * MotivateTextHeight)
 
-	dc := gg.NewContext(0, 0)
-	dc.SetFontFace(topFace)
-	wrapped := dc.WordWrap(top, float64(w))
-	_, topH := dc.MeasureMultilineString(strings.Join(wrapped, "\n"), linespc)
-	dc.SetFontFace(botFace)
-	wrapped = dc.WordWrap(top, float64(w))
-	var botH float64
+	topL := fitLayout(float64(h/8), maxH, plainText(orFont(o.TopFont), top, opts))
+	botL := fitLayout(float64(h/8)*bottomSize, maxH, plainText(orFont(o.BottomFont), bot, opts))
+	var botH int
 	if strings.TrimSpace(bot) != "" {
-		_, botH = dc.MeasureMultilineString(strings.Join(wrapped, "\n"), linespc)
+		botH = botL.Height
 	}
 
-	imgH := h + int(topH) + int(botH) + padding*3
+	imgH := h + topL.Height + botH + padding*3
 	if botH != 0 {
 		imgH += padding
 	}
-	if int(imgH)%2 != 0 {
-		imgH = imgH + 1.0
+	if imgH%2 != 0 {
+		imgH++
 	}
 	imgW := w + padding*2
 
-	dc = gg.NewContext(imgW, imgH)
-	dc.SetRGB(0, 0, 0)
-	dc.Clear()
-	dc.SetRGB(1, 1, 1)
-	dc.DrawRectangle(float64(padding)-2, float64(padding)-2, float64(w)+4, float64(h)+4)
-	dc.Fill()
-	dc.SetRGBA(0, 0, 0, 0)
-	dc.DrawRectangle(float64(padding), float64(padding), float64(w), float64(h))
-	dc.Fill()
-	dc.SetRGB(1, 1, 1)
-	dc.SetFontFace(topFace)
-	dc.DrawStringWrapped(top, float64(imgW)/2,
-		float64(padding*2+h)+topH/2,
-		0.5, 0.5,
-		float64(imgW), linespc, gg.AlignCenter)
-	dc.SetFontFace(botFace)
+	m := image.NewRGBA(image.Rect(0, 0, imgW, imgH))
+	draw.Draw(m, m.Bounds(), orColor(o.Background, color.Black), image.Point{}, draw.Src)
+	if borderW > 0 {
+		border := image.Rect(padding-borderW, padding-borderW, padding+w+borderW, padding+h+borderW)
+		draw.Draw(m, border, orColor(o.Border, color.White), image.Point{}, draw.Src)
+	}
+	text := orColor(o.Color, color.White)
+	topL.Draw(m, image.Pt(padding, padding*2+h), text, true)
 	if botH != 0 {
-		dc.DrawStringWrapped(bot, float64(imgW)/2,
-			float64(padding*3+h)+topH+botH/2,
-			0.5, 0.5,
-			float64(imgW), linespc, gg.AlignCenter)
+		botL.Draw(m, image.Pt(padding, padding*3+h+topL.Height), text, true)
 	}
 
-	return dc.Image(), image.Point{-padding, -padding}
-}
-
-func drawOutlinedText(dc *gg.Context, s string,
-	x, y, ax, ay, width float64, sp float64) {
-	dc.SetRGB(0, 0, 0)
-	n := dc.FontHeight() / 20
-	w := width * .95
-	dc.DrawStringWrapped(s, x+n, y+n, ax, ay, w, sp, gg.AlignCenter)
-	dc.DrawStringWrapped(s, x-n, y-n, ax, ay, w, sp, gg.AlignCenter)
-	dc.DrawStringWrapped(s, x+n, y-n, ax, ay, w, sp, gg.AlignCenter)
-	dc.DrawStringWrapped(s, x-n, y+n, ax, ay, w, sp, gg.AlignCenter)
-	dc.SetRGB(1, 1, 1)
-	dc.DrawStringWrapped(s, x, y, ax, ay, w, sp, gg.AlignCenter)
-}
-
-func limitWrappedTextHeight(dc *gg.Context,
-	fontf *truetype.Font, text string, w, desiredH, linespc float64) (face font.Face, height float64) {
-	textH := func() float64 {
-		wrapped := dc.WordWrap(text, w)
-		withBreaks := strings.Join(wrapped, "\n")
-		_, textH := dc.MeasureMultilineString(withBreaks, linespc)
-		return textH
-	}
-	height = textH()
-	for height > desiredH {
-		face = truetype.NewFace(fontf, &truetype.Options{Size: dc.FontHeight() * 0.75})
-		dc.SetFontFace(face)
-		height = textH()
-	}
-	return
+	return m, image.Point{-padding, -padding}
 }
@@ -3,13 +3,23 @@ package memegen
 import (
 	"bytes"
 	"image"
+	"image/color"
 	"image/draw"
 	"image/png"
 	"io"
 	"os"
+	"slices"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/disintegration/imaging"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/f32"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
 )
 
 func BenchmarkMeme(b *testing.B) {
@@ -39,6 +49,32 @@ func BenchmarkMemeParallel(b *testing.B) {
 	})
 }
 
+// BenchmarkText draws text with faces from the cache, and with faces made for
+// each meme like before faces were cached.
+func BenchmarkText(b *testing.B) {
+	for _, bb := range []struct {
+		name    string
+		newFace func(string, float64) font.Face
+	}{
+		{"cached", newFace},
+		{"uncached", func(style string, size float64) font.Face {
+			return makeFace(style, 0, size)
+		}},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			m := image.NewRGBA(image.Rect(0, 0, 1000, 1000))
+			b.RunParallel(func(p *testing.PB) {
+				for p.Next() {
+					l := LayoutText(bb.newFace("impact", 125),
+						"top text here, with wrapping if needed",
+						LayoutOptions{Width: 1000, Balance: true})
+					l.Draw(m, image.Point{}, image.White, true)
+				}
+			})
+		})
+	}
+}
+
 func makeDrawable(img image.Image) draw.Image {
 	var drawer, drawable = img.(draw.Image)
 	var _, paletted = img.(*image.Paletted)
@@ -48,3 +84,627 @@ func makeDrawable(img image.Image) draw.Image {
 		return drawer
 	}
 }
+
+func testTemplates(t *testing.T) map[string]*Template {
+	t.Helper()
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 200, 100)))
+	fsys := fstest.MapFS{
+		"blank.png": {Data: buf.Bytes()},
+		"twobox.toml": {Data: []byte(`
+description = "two boxes"
+image = "blank.png"
+
+[[box]]
+x = 0
+y = 0
+w = 100
+h = 100
+outline = "000000"
+
+[[box]]
+x = 100
+y = 0
+w = 100
+h = 100
+font = "times"
+color = "#ff0000"
+align = "left"
+rotation = 15
+`)},
+		"onebox.json": {Data: []byte(`{"image": "blank.png",
+			"boxes": [{"x": 10, "y": 10, "w": 50, "h": 20}]}`)},
+		"notes.txt": {Data: []byte("not a template")},
+	}
+	templates, err := LoadTemplates(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templates
+}
+
+func TestLoadTemplates(t *testing.T) {
+	templates := testTemplates(t)
+	if len(templates) != 2 {
+		t.Fatalf("got %d templates, want 2", len(templates))
+	}
+	two := templates["twobox"]
+	if two == nil || two.Description != "two boxes" || len(two.Boxes) != 2 {
+		t.Fatalf("got %+v", two)
+	}
+	if box := two.Boxes[1]; box.X != 100 || box.Font != "times" || box.Rotation != 15 {
+		t.Errorf("got second box %+v", box)
+	}
+	if one := templates["onebox"]; one == nil || one.Boxes[0].W != 50 {
+		t.Errorf("got %+v", one)
+	}
+
+	_, err := LoadTemplates(fstest.MapFS{
+		"bad.toml": {Data: []byte(`image = "missing.png"`)},
+	})
+	if err == nil {
+		t.Error("expected error for missing image")
+	}
+}
+
+func TestTemplateRender(t *testing.T) {
+	two := testTemplates(t)["twobox"]
+	m, err := two.Render([]string{"left text", "right text that has to wrap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds() != two.Image.Bounds() {
+		t.Errorf("got bounds %v, want %v", m.Bounds(), two.Image.Bounds())
+	}
+	// text is drawn into each box and nowhere else
+	var left, right bool
+	img := m.(*image.NRGBA)
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			if img.NRGBAAt(x, y).A != 0 {
+				left = left || x < 100
+				right = right || x >= 100
+			}
+		}
+	}
+	if !left || !right {
+		t.Errorf("got text in left box %v, right box %v", left, right)
+	}
+	if _, err = two.Render([]string{"a", "b", "c"}); err == nil {
+		t.Error("expected error for too many texts")
+	}
+}
+
+func TestTextBoxShadowUpLeft(t *testing.T) {
+	b := TextBox{W: 30, H: 100, Shadow: "000000", ShadowOffset: -40}
+	m := b.render("x")
+	if !image.Rect(0, 0, b.W, b.H).In(m.Bounds()) {
+		t.Errorf("rendered %v, which doesn't cover the box", m.Bounds())
+	}
+	// the shadow is above and to the left of the text
+	var shadow bool
+	for y := m.Rect.Min.Y; y < 0; y++ {
+		for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+			shadow = shadow || m.NRGBAAt(x, y).A != 0
+		}
+	}
+	if !shadow {
+		t.Error("no shadow above the box")
+	}
+}
+
+func TestSplitEmoji(t *testing.T) {
+	var got []string
+	for _, seg := range splitEmoji("a😀b👨‍👩‍👧🇺🇸1️⃣❤️<a:x:1>#c©") {
+		if seg.emoji != nil {
+			got = append(got, "["+seg.text+"]")
+		} else {
+			got = append(got, seg.text)
+		}
+	}
+	want := []string{"a", "[😀]", "b", "[👨‍👩‍👧]", "[🇺🇸]", "[1️⃣]",
+		"[❤️]", "[<a:x:1>]", "#c©"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEmojiCodepoints(t *testing.T) {
+	for text, want := range map[string]string{
+		"😀":     "1f600",
+		"❤️":    "2764",
+		"1️⃣":   "31-20e3",
+		"👁️‍🗨️": "1f441-fe0f-200d-1f5e8-fe0f",
+	} {
+		if got := (Emoji{Text: text}).Codepoints(); got != want {
+			t.Errorf("%q: got %s, want %s", text, got, want)
+		}
+	}
+}
+
+type squareEmoji struct{}
+
+func (squareEmoji) EmojiImage(e Emoji) (image.Image, error) {
+	if e.Text == "😀" {
+		return image.NewNRGBA(image.Rect(0, 0, 72, 72)), nil
+	}
+	return nil, nil
+}
+
+func TestMeasureEmoji(t *testing.T) {
+	defer func(prev EmojiSource) { Emojis = prev }(Emojis)
+	Emojis = squareEmoji{}
+	face := truetype.NewFace(impactFont, &truetype.Options{Size: 40})
+	dr := &font.Drawer{Face: face}
+	m := face.Metrics()
+	if got, want := measureString(dr, "😀", emojiImages{}), m.Ascent+m.Descent; got != want {
+		t.Errorf("got emoji width %v, want %v", got, want)
+	}
+	// custom emoji without images are measured as their name
+	if got, want := measureString(dr, "<:pog:1>", emojiImages{}), dr.MeasureString(":pog:"); got != want {
+		t.Errorf("got custom emoji width %v, want %v", got, want)
+	}
+}
+
+type countingEmoji struct {
+	squareEmoji
+	lookups int
+}
+
+func (c *countingEmoji) EmojiImage(e Emoji) (image.Image, error) {
+	c.lookups++
+	return c.squareEmoji.EmojiImage(e)
+}
+
+func TestLayoutEmojiLookups(t *testing.T) {
+	source := new(countingEmoji)
+	defer func(prev EmojiSource) { Emojis = prev }(Emojis)
+	Emojis = source
+	face := newFace("impact", 40)
+	l := LayoutText(face, "😀 wrap 😀 these 😀 words 😀 <:pog:1>", LayoutOptions{Width: 150, Balance: true})
+	m := image.NewRGBA(image.Rect(0, 0, 150, l.Height))
+	l.DrawOutlined(m, image.Point{}, image.White, Outline{Width: 2, Color: color.Black})
+	if source.lookups != 2 {
+		t.Errorf("emoji were looked up %d times, want 2", source.lookups)
+	}
+}
+
+func TestFallbackFont(t *testing.T) {
+	goFont, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = AddFallbackFont("caption", goFont); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		delete(fallbacks, "caption")
+		clearFaceCache()
+	}()
+	if err = AddFallbackFont("comic sans", goFont); err == nil {
+		t.Error("expected error for unknown style")
+	}
+
+	// the caption font has no λ, so it's measured with the fallback
+	face := newFace("caption", 40)
+	goFace := truetype.NewFace(goFont, &truetype.Options{Size: 40})
+	captionFace := truetype.NewFace(captionFont, &truetype.Options{Size: 40})
+	want := font.MeasureString(captionFace, "a") + font.MeasureString(goFace, "λ")
+	if got := font.MeasureString(face, "aλ"); got != want {
+		t.Errorf("got width %v, want %v", got, want)
+	}
+	if face.Metrics() != captionFace.Metrics() {
+		t.Error("metrics aren't those of the caption font")
+	}
+	if _, ok := makeFace("impact", 0, 40).(*fallbackFace); ok {
+		t.Error("impact shouldn't have fallbacks")
+	}
+}
+
+func TestVisualOrder(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		rtl  bool
+		want string
+	}{
+		{"hello world", false, "hello world"},
+		{"hello שלום world", false, "hello םולש world"},
+		{"שלום עולם", true, "םלוע םולש"},
+		{"שלום 123 עולם", true, "םלוע 123 םולש"},
+		{"שלום (עולם)", true, "(םלוע) םולש"},
+		{"שלום 😀 abc", true, "abc 😀 םולש"},
+	} {
+		if got := visualOrder(tt.in, tt.rtl); got != tt.want {
+			t.Errorf("visualOrder(%q, %v) = %q, want %q", tt.in, tt.rtl, got, tt.want)
+		}
+	}
+	if !isRTL("123 שלום hello") || isRTL("hello שלום") {
+		t.Error("isRTL should go by the first strong character")
+	}
+}
+
+func TestShapeArabic(t *testing.T) {
+	for in, want := range map[string]string{
+		// meem initial, reh final, hah initial, beh medial, alef final
+		"مرحبا": "ﻣﺮﺣﺒﺎ",
+		// lam alef ligature, isolated
+		"لا": "ﻻ",
+		// beh then the final lam alef ligature
+		"بلا": "ﺑﻼ",
+		// marks don't break joining
+		"بَب": "ﺑَﺐ",
+		"abc": "abc",
+	} {
+		if got := shapeArabic(in); got != want {
+			t.Errorf("shapeArabic(%q) = %+q, want %+q", in, got, want)
+		}
+	}
+}
+
+func TestLayoutRTL(t *testing.T) {
+	face := truetype.NewFace(timesFont, &truetype.Options{Size: 20})
+	l := LayoutText(face, "שלום עולם זה טקסט ארוך\nhello", LayoutOptions{Width: 100})
+	lines := l.Lines
+	if len(lines) < 3 {
+		t.Fatalf("got %d lines, want the hebrew to wrap", len(lines))
+	}
+	var right int
+	for _, line := range lines[:len(lines)-1] {
+		right = max(right, line.Box.Max.X)
+	}
+	for _, line := range lines[:len(lines)-1] {
+		if !line.RTL {
+			t.Errorf("line %q isn't right-to-left", line.Text)
+		}
+		// right-aligned with the rest of the paragraph
+		if line.Box.Max.X != right {
+			t.Errorf("line %q ends at %d, want %d", line.Text, line.Box.Max.X, right)
+		}
+	}
+	if last := lines[len(lines)-1]; last.RTL || last.Text != "hello" {
+		t.Errorf("got last line %+v", last)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	face := truetype.NewFace(timesFont, &truetype.Options{Size: 20})
+	texts := func(l *Layout) []string {
+		var s []string
+		for _, line := range l.Lines {
+			s = append(s, line.Text)
+		}
+		return s
+	}
+	text := "one two three four five six seven"
+	width := measureString(&font.Drawer{Face: face}, "one two three four five", nil).Ceil()
+
+	greedy := LayoutText(face, text, LayoutOptions{Width: width})
+	if got, want := texts(greedy), []string{"one two three four five", "six seven"}; !slices.Equal(got, want) {
+		t.Errorf("greedy: got lines %q, want %q", got, want)
+	}
+	balanced := LayoutText(face, text, LayoutOptions{Width: width, Balance: true})
+	if got, want := texts(balanced), []string{"one two three four", "five six seven"}; !slices.Equal(got, want) {
+		t.Errorf("balanced: got lines %q, want %q", got, want)
+	}
+
+	l := LayoutText(face, "a\n\nb", LayoutOptions{Width: width, LineSpacing: 1.5})
+	if got, want := texts(l), []string{"a", "", "b"}; !slices.Equal(got, want) {
+		t.Errorf("newlines: got lines %q, want %q", got, want)
+	}
+	faceh := face.Metrics().Height.Ceil()
+	pad := int(float64(faceh) * 0.5)
+	if l.Height != 3*faceh+2*pad || l.Lines[2].Box.Min.Y != 2*(faceh+pad) {
+		t.Errorf("newlines: got height %d and last line at %d", l.Height, l.Lines[2].Box.Min.Y)
+	}
+
+	long := LayoutText(face, "a supercalifragilisticexpialidocious word", LayoutOptions{Width: 80})
+	for i, line := range long.Lines {
+		if line.Box.Dx() > 80 {
+			t.Errorf("line %q is %d wide", line.Text, line.Box.Dx())
+		}
+		if line.Broken != strings.HasSuffix(line.Text, "-") {
+			t.Errorf("line %d %q: Broken is %v", i, line.Text, line.Broken)
+		}
+	}
+	if !long.broken() {
+		t.Errorf("long word wasn't broken: %q", texts(long))
+	}
+	if got := strings.ReplaceAll(strings.Join(texts(long)[1:], ""), "-", ""); !strings.HasPrefix(got, "supercalifragilisticexpialidocious") {
+		t.Errorf("long word was broken into %q", texts(long))
+	}
+}
+
+func TestFitLayout(t *testing.T) {
+	opts := LayoutOptions{Width: 300, Balance: true}
+	short := fitLayout(40, 100, plainText("impact", "short", opts))
+	if want := LayoutText(newFace("impact", 40), "short", opts); short.Height != want.Height {
+		t.Errorf("short text was shrunk to %d high, want %d", short.Height, want.Height)
+	}
+
+	text := strings.Repeat("a lot of text that won't fit ", 10)
+	long := fitLayout(40, 100, plainText("impact", text, opts))
+	if long.Height > 100 || long.broken() {
+		t.Fatalf("got layout %d high with %d lines", long.Height, len(long.Lines))
+	}
+	// the size found is the largest one that fits
+	faceh := long.face.Metrics().Height
+	for size := 7.0; size < 40; size++ {
+		if newFace("impact", size).Metrics().Height <= faceh {
+			continue
+		}
+		if l := LayoutText(newFace("impact", size), text, opts); l.Height <= 100 {
+			t.Errorf("text fits at size %g, but was laid out %d high", size, long.Height)
+		}
+		break
+	}
+}
+
+func TestCachedFace(t *testing.T) {
+	text := "Glyphs at odd places, AVAWAY"
+	draw := func(face font.Face) *image.Alpha {
+		m := image.NewAlpha(image.Rect(0, 0, 600, 100))
+		dr := &font.Drawer{Dst: m, Src: image.Opaque, Face: face}
+		for i, y := range []fixed.Int26_6{fixed.I(40), fixed.I(80) + 37} {
+			dr.Dot = fixed.Point26_6{X: fixed.I(3) + fixed.Int26_6(i*21), Y: y}
+			dr.DrawString(text)
+		}
+		return m
+	}
+	want := draw(makeFace("times", 0, 32))
+	face := newFace("times", 32)
+	if newFace("times", 32) != face {
+		t.Error("face wasn't reused")
+	}
+	for i := 0; i < 2; i++ {
+		if got := draw(face); !bytes.Equal(got.Pix, want.Pix) {
+			t.Fatalf("pass %d: cached face drew text differently", i)
+		}
+	}
+}
+
+func TestParseMarkup(t *testing.T) {
+	red := markupColors["red"]
+	for _, tt := range []struct {
+		in   string
+		want []Run
+	}{
+		{"plain text", []Run{{Text: "plain text"}}},
+		{"**bold** *it* __u__", []Run{
+			{Text: "bold", Style: Style{Variant: Bold}},
+			{Text: " "},
+			{Text: "it", Style: Style{Variant: Italic}},
+			{Text: " "},
+			{Text: "u", Style: Style{Underline: true}},
+		}},
+		{"***both***", []Run{{Text: "both", Style: Style{Variant: Bold | Italic}}}},
+		{"{red}a {big}b{/}{/} c", []Run{
+			{Text: "a ", Style: Style{Color: red}},
+			{Text: "b", Style: Style{Color: red, Scale: 1.25}},
+			{Text: " c"},
+		}},
+		{"{#00ff00}x", []Run{{Text: "x", Style: Style{Color: color.NRGBA{0, 0xff, 0, 0xff}}}}},
+		// markers which don't open or close spans are left alone
+		{"2 * 3 * 4", []Run{{Text: "2 * 3 * 4"}}},
+		{"snake_case and __init", []Run{{Text: "snake_case and __init"}}},
+		{"{unknown} {/}", []Run{{Text: "{unknown} {/}"}}},
+		{`\*not italic\*`, []Run{{Text: "*not italic*"}}},
+		// backslashes before anything but a marker which would open or
+		// close a span are kept
+		{`¯\_(ツ)_/¯`, []Run{{Text: `¯\_(ツ)_/¯`}}},
+		{`C:\{dir}\*`, []Run{{Text: `C:\{dir}\*`}}},
+		{`\{red}a{/} \\ b`, []Run{{Text: `{red}a{/} \\ b`}}},
+		{"<:pepe__hands__:123>", []Run{{Text: "<:pepe__hands__:123>"}}},
+	} {
+		if got := ParseMarkup(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseMarkup(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNestedSizeTags(t *testing.T) {
+	for _, tt := range []struct {
+		tag   string
+		scale float64
+	}{{"{big}", maxTextScale}, {"{small}", minTextScale}} {
+		runs := ParseMarkup(strings.Repeat(tt.tag, 20) + "x")
+		if len(runs) != 1 || runs[0].Style.scale() != tt.scale {
+			t.Errorf("%s nested 20 times: got %+v, want scale %g", tt.tag, runs, tt.scale)
+		}
+	}
+	// this used to try to make a face hundreds of times larger than the
+	// image
+	m, _ := Caption(500, 500, strings.Repeat("{big}", 20)+"x")
+	if h := m.Bounds().Dy(); h > 1000 {
+		t.Errorf("caption is %d high", h)
+	}
+}
+
+func TestLayoutMarkup(t *testing.T) {
+	opts := LayoutOptions{Width: 400}
+	plain := LayoutText(newFace("caption", 30), "some text", opts)
+	l := LayoutMarkup("caption", 30, "some text", opts)
+	if !slices.EqualFunc(l.Lines, plain.Lines, func(a, b Line) bool {
+		return a.Text == b.Text && a.Box == b.Box
+	}) {
+		t.Errorf("plain text was laid out differently with markup")
+	}
+
+	l = LayoutMarkup("caption", 30, "some **bold** text\n{big}big{/}", opts)
+	if len(l.Lines) != 2 {
+		t.Fatalf("got %d lines", len(l.Lines))
+	}
+	if got := l.Lines[0].Runs; len(got) != 3 || got[1] != (Run{Text: "bold", Style: Style{Variant: Bold}}) {
+		t.Errorf("got runs %+v", got)
+	}
+	if l.Lines[0].Text != "some bold text" {
+		t.Errorf("got text %q", l.Lines[0].Text)
+	}
+	if l.Lines[1].Box.Dy() <= plain.Lines[0].Box.Dy() {
+		t.Errorf("line of big text is %d high, no taller than %d",
+			l.Lines[1].Box.Dy(), plain.Lines[0].Box.Dy())
+	}
+}
+
+func TestFontVariant(t *testing.T) {
+	if _, ok := makeFace("caption", Bold, 30).(*boldFace); !ok {
+		t.Error("bold wasn't synthesized")
+	}
+	goFont, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = AddFontVariant("caption", Bold, goFont); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		delete(variants, variantKey{"caption", Bold})
+		clearFaceCache()
+	}()
+	goFace := truetype.NewFace(goFont, &truetype.Options{Size: 30})
+	if got, want := font.MeasureString(newVariantFace("caption", Bold, 30), "abc"),
+		font.MeasureString(goFace, "abc"); got != want {
+		t.Errorf("bold caption text is %v wide, want %v", got, want)
+	}
+	// italics are synthesized from the bold font
+	face := makeFace("caption", Bold|Italic, 30)
+	if i, ok := face.(*italicFace); !ok {
+		t.Errorf("got face %T", face)
+	} else if _, ok := i.Face.(*boldFace); ok {
+		t.Error("bold was synthesized despite there being a bold font")
+	}
+}
+
+func TestStrokeJoins(t *testing.T) {
+	square := [][]f32.Vec2{{{0, 0}, {20, 0}, {20, 20}, {0, 20}}}
+	for _, tt := range []struct {
+		join   Join
+		corner bool
+	}{
+		{JoinRound, false},
+		{JoinMiter, true},
+		{JoinBevel, false},
+	} {
+		z := vector.NewRasterizer(40, 40)
+		strokeContours(z, square, f32.Vec2{10, 10}, 4, tt.join)
+		m := image.NewAlpha(image.Rect(0, 0, 40, 40))
+		z.Draw(m, m.Bounds(), image.Opaque, image.Point{})
+		if a := m.AlphaAt(20, 7).A; a != 0xff {
+			t.Errorf("join %d: edge isn't stroked, alpha %d", tt.join, a)
+		}
+		if a := m.AlphaAt(20, 4).A; a != 0 {
+			t.Errorf("join %d: stroke is too wide, alpha %d", tt.join, a)
+		}
+		// inside the square is stroked too, rather than cancelled out
+		if a := m.AlphaAt(12, 12).A; a != 0xff {
+			t.Errorf("join %d: inner edge isn't stroked, alpha %d", tt.join, a)
+		}
+		if corner := m.AlphaAt(6, 6).A == 0xff; corner != tt.corner {
+			t.Errorf("join %d: corner stroked is %v, want %v", tt.join, corner, tt.corner)
+		}
+	}
+}
+
+func TestDrawOutlined(t *testing.T) {
+	l := LayoutText(newFace("impact", 40), "I", LayoutOptions{})
+	m := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	pt := image.Pt(30, 30)
+	l.DrawOutlined(m, pt, image.White, Outline{
+		Width:        3,
+		Color:        color.NRGBA{0xff, 0, 0, 0xff},
+		ShadowOffset: image.Pt(10, 10),
+		ShadowColor:  color.NRGBA{0, 0, 0xff, 0xff},
+	})
+	box := l.Lines[0].Box.Add(pt)
+	mid := (box.Min.Y + box.Max.Y) / 2
+	var left int
+	for left = box.Min.X - 10; m.RGBAAt(left, mid).A == 0 || m.RGBAAt(left, mid).R != 0xff; left++ {
+	}
+	// a stroke 3 pixels wide, then the white glyph
+	if c := m.RGBAAt(left+1, mid); c != (color.RGBA{0xff, 0, 0, 0xff}) {
+		t.Errorf("got %v in the outline", c)
+	}
+	if c := m.RGBAAt(left+5, mid); c != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("got %v in the glyph", c)
+	}
+	if c := m.RGBAAt(box.Max.X+5, box.Max.Y+5); c.B == 0 {
+		t.Errorf("got %v where the shadow should be", c)
+	}
+}
+
+func TestMotivate(t *testing.T) {
+	long := strings.Repeat("a long subtitle that wraps ", 4)
+	short, _ := Motivate(400, 400, "top", "bottom", MotivateOptions{})
+	tall, _ := Motivate(400, 400, "top", long, MotivateOptions{})
+	// the space for the subtitle is measured from the subtitle, not the title
+	if tall.Bounds().Dy() <= short.Bounds().Dy() {
+		t.Errorf("poster with a long subtitle is %d high, want more than %d",
+			tall.Bounds().Dy(), short.Bounds().Dy())
+	}
+
+	width := 5
+	o := MotivateOptions{Background: color.White, Border: color.Black, BorderWidth: &width}
+	m, pt := Motivate(400, 400, "top", "", o)
+	if c := color.RGBAModel.Convert(m.At(0, 0)); c != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("got background %v", c)
+	}
+	if c := color.RGBAModel.Convert(m.At(-pt.X-5, -pt.Y-5)); c != (color.RGBA{0, 0, 0, 0xff}) {
+		t.Errorf("got border %v", c)
+	}
+
+	// a border 0 wide isn't drawn at all
+	width = 0
+	if m, pt := Motivate(400, 400, "top", "", o); color.RGBAModel.Convert(m.At(-pt.X-1, -pt.Y-1)) !=
+		(color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("got %v just outside the image with no border", m.At(-pt.X-1, -pt.Y-1))
+	}
+	width = 5
+
+	o.Times = 2
+	nested, nestedPt := Motivate(400, 400, "top", "", o)
+	inner := image.Rectangle{Max: m.Bounds().Size()}.Add(nestedPt.Sub(pt).Mul(-1))
+	if nestedPt.X >= pt.X || nested.Bounds().Dx() <= m.Bounds().Dx() {
+		t.Fatalf("nested poster %v at %v, want it around %v", nested.Bounds(), nestedPt, m.Bounds())
+	}
+	for y := inner.Min.Y; y < inner.Max.Y; y += 7 {
+		for x := inner.Min.X; x < inner.Max.X; x += 7 {
+			p := image.Pt(x, y).Sub(inner.Min)
+			if nested.At(x, y) != m.At(p.X, p.Y) {
+				t.Fatalf("inner poster differs at %v", p)
+			}
+		}
+	}
+}
+
+func TestMotivateSize(t *testing.T) {
+	m, _ := Motivate(1920, 1080, "top", "bottom", MotivateOptions{Times: 5})
+	if size := m.Bounds().Size(); max(size.X, size.Y) > MaxMotivateSize {
+		t.Errorf("nested poster is %v, larger than %d", size, MaxMotivateSize)
+	}
+	once, _ := Motivate(1920, 1080, "top", "bottom", MotivateOptions{})
+	if m.Bounds().Dy() <= once.Bounds().Dy() {
+		t.Error("nothing was nested")
+	}
+}
+
+func TestMotivateOptionsSet(t *testing.T) {
+	var o MotivateOptions
+	for _, kv := range [][2]string{{"bg", "red"}, {"border", "#00ff00"},
+		{"border-width", "4"}, {"bottom-font", "impact"}, {"bottom-size", "0.5"}} {
+		if err := o.Set(kv[0], kv[1]); err != nil {
+			t.Errorf("setting %s: %v", kv[0], err)
+		}
+	}
+	if o.Background != markupColors["red"] || o.Border != (color.NRGBA{0, 0xff, 0, 0xff}) ||
+		o.BorderWidth == nil || *o.BorderWidth != 4 || o.TopFont != "" || o.BottomFont != "impact" || o.BottomSize != 0.5 {
+		t.Errorf("got %+v", o)
+	}
+	for _, kv := range [][2]string{{"bg", "nope"}, {"font", "comic"}, {"border-width", "-1"},
+		{"bottom-size", "10"}, {"what", "1"}} {
+		if err := o.Set(kv[0], kv[1]); err == nil {
+			t.Errorf("setting %s to %s succeeded", kv[0], kv[1])
+		}
+	}
+	if err := o.Set("border-width", "0"); err != nil || *o.BorderWidth != 0 {
+		t.Errorf("setting border-width to 0: %v", err)
+	}
+}
@@ -0,0 +1,372 @@
+package memegen
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/f32"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// Join is how the corners of outlines are drawn.
+type Join int
+
+const (
+	JoinRound Join = iota
+	JoinMiter
+	JoinBevel
+)
+
+// parseJoin parses "round", "miter" or "bevel". An empty string is round.
+func parseJoin(s string) (Join, bool) {
+	switch s {
+	case "", "round":
+		return JoinRound, true
+	case "miter":
+		return JoinMiter, true
+	case "bevel":
+		return JoinBevel, true
+	}
+	return 0, false
+}
+
+// miterLimit is how many times the width of an outline a miter can reach
+// out from a corner before it's beveled instead.
+const miterLimit = 4
+
+// Outline is how text drawn with DrawOutlined is outlined and shadowed.
+type Outline struct {
+	// Width is how far the outline reaches out from the edges of glyphs,
+	// in pixels. If zero, there's no outline.
+	Width float64
+	Color color.Color
+	Join  Join
+	// ShadowOffset is where the drop shadow of the text is, relative to
+	// the text. If zero, there's no shadow.
+	ShadowOffset image.Point
+	ShadowColor  color.Color
+	// ShadowBlur is the standard deviation of the blur of the shadow.
+	ShadowBlur float64
+}
+
+// DrawOutlined is like Draw, but draws the text with its outline and drop
+// shadow under it.
+func (l *Layout) DrawOutlined(dst draw.Image, pt image.Point, src image.Image, o Outline) {
+	hasShadow := o.ShadowOffset != image.Point{}
+	if o.Width <= 0 && !hasShadow {
+		l.Draw(dst, pt, src, true)
+		return
+	}
+	// the outline and shadow are drawn into masks covering the layout and
+	// as far around it as they reach
+	margin := int(math.Ceil(o.Width*miterLimit + 3*o.ShadowBlur))
+	r := image.Rect(0, 0, l.Width, l.Height).Add(pt).Inset(-margin)
+	for _, line := range l.Lines {
+		r = r.Union(line.Box.Add(pt).Inset(-margin))
+	}
+	stroke := image.NewAlpha(r)
+	if o.Width > 0 {
+		l.stroke(stroke, pt, o)
+	}
+	if hasShadow {
+		shape := image.NewAlpha(r)
+		l.Draw(shape, pt, image.Opaque, true)
+		draw.Draw(shape, r, stroke, r.Min, draw.Over)
+		var mask image.Image = shape
+		if o.ShadowBlur > 0 {
+			mask = imaging.Blur(shape, o.ShadowBlur)
+		}
+		shadowR := r.Add(o.ShadowOffset)
+		draw.DrawMask(dst, shadowR, image.NewUniform(o.ShadowColor), image.Point{},
+			mask, mask.Bounds().Min, draw.Over)
+	}
+	if o.Width > 0 {
+		draw.DrawMask(dst, r, image.NewUniform(o.Color), image.Point{}, stroke, r.Min, draw.Over)
+	}
+	l.Draw(dst, pt, src, true)
+}
+
+// stroke draws the outlines of the glyphs of the layout into mask.
+func (l *Layout) stroke(mask *image.Alpha, pt image.Point, o Outline) {
+	b := mask.Bounds()
+	z := vector.NewRasterizer(b.Dx(), b.Dy())
+	var stroked bool
+	for _, line := range l.Lines {
+		r := line.Box.Add(pt)
+		dot := fixed.Point26_6{X: fixed.I(r.Min.X), Y: fixed.I(r.Min.Y) + line.ascent}
+		for i, run := range line.Runs {
+			face := line.faces[i]
+			dot = eachGlyph(face, dot, run.Text, l.emojis, func(dot fixed.Point26_6, r rune) {
+				of, ok := face.(outliner)
+				var contours [][]f32.Vec2
+				if ok {
+					contours = of.outline(r)
+				}
+				if !ok || contours == nil {
+					// faces without outlines have their glyphs
+					// smeared around instead
+					strokeMask(mask, face, dot, r, o.Width)
+					return
+				}
+				origin := f32.Vec2{
+					float32(dot.X)/64 - float32(b.Min.X),
+					float32(dot.Y)/64 - float32(b.Min.Y),
+				}
+				strokeContours(z, contours, origin, float32(o.Width), o.Join)
+				stroked = true
+			})
+		}
+	}
+	if stroked {
+		z.Draw(mask, b, image.Opaque, image.Point{})
+	}
+}
+
+// eachGlyph calls fn with each rune of s outside of emoji and the dot it's
+// drawn at, the same as drawString, returning where the dot ends up.
+func eachGlyph(face font.Face, dot fixed.Point26_6, s string, emojis emojiImages,
+	fn func(dot fixed.Point26_6, r rune)) fixed.Point26_6 {
+	dr := &font.Drawer{Face: face, Dot: dot}
+	for _, seg := range splitEmoji(s) {
+		text := seg.text
+		if seg.emoji != nil {
+			if img := emojis.image(seg.emoji); img != nil {
+				dr.Dot.X += emojiWidth(face, img)
+				continue
+			}
+			text = emojiText(seg.emoji)
+		}
+		prev := rune(-1)
+		for _, r := range text {
+			if prev >= 0 {
+				dr.Dot.X += face.Kern(prev, r)
+			}
+			fn(dr.Dot, r)
+			advance, _ := face.GlyphAdvance(r)
+			dr.Dot.X += advance
+			prev = r
+		}
+	}
+	return dr.Dot
+}
+
+// strokeMask approximates stroking a glyph by drawing its mask around the
+// dot, for faces without outlines.
+func strokeMask(dst *image.Alpha, face font.Face, dot fixed.Point26_6, r rune, width float64) {
+	n := max(int(math.Round(width)), 1)
+	for _, off := range []image.Point{{-n, -n}, {-n, n}, {n, -n}, {n, n},
+		{0, -n}, {0, n}, {-n, 0}, {n, 0}} {
+		d := dot.Add(fixed.P(off.X, off.Y))
+		dr, mask, maskp, _, ok := face.Glyph(d, r)
+		if ok {
+			draw.DrawMask(dst, dr, image.Opaque, image.Point{}, mask, maskp, draw.Over)
+		}
+	}
+}
+
+// outliner is implemented by faces which can give the outlines of their
+// glyphs.
+type outliner interface {
+	// outline returns the contours of the glyph of r as closed polygons,
+	// in pixels relative to the dot with y going down, or nil if there
+	// are none.
+	outline(r rune) [][]f32.Vec2
+}
+
+// ttFace is a truetype face which knows its font, so that it can give the
+// outlines of its glyphs.
+type ttFace struct {
+	font.Face
+	font  *truetype.Font
+	scale fixed.Int26_6
+}
+
+func newTTFace(f *truetype.Font, opts *truetype.Options) *ttFace {
+	return &ttFace{
+		Face:  truetype.NewFace(f, opts),
+		font:  f,
+		scale: fixed.Int26_6(0.5 + opts.Size*64),
+	}
+}
+
+func (f *ttFace) outline(r rune) [][]f32.Vec2 {
+	var buf truetype.GlyphBuf
+	if err := buf.Load(f.font, f.scale, f.font.Index(r), font.HintingNone); err != nil {
+		return nil
+	}
+	var contours [][]f32.Vec2
+	start := 0
+	for _, end := range buf.Ends {
+		contours = append(contours, flattenContour(buf.Points[start:end]))
+		start = end
+	}
+	return contours
+}
+
+// flattenContour turns a TrueType contour, made of quadratic curves, into a
+// polygon.
+func flattenContour(ps []truetype.Point) []f32.Vec2 {
+	if len(ps) == 0 {
+		return nil
+	}
+	vec := func(p truetype.Point) f32.Vec2 {
+		return f32.Vec2{float32(p.X) / 64, -float32(p.Y) / 64}
+	}
+	mid := func(a, b f32.Vec2) f32.Vec2 {
+		return f32.Vec2{(a[0] + b[0]) / 2, (a[1] + b[1]) / 2}
+	}
+	onCurve := func(p truetype.Point) bool { return p.Flags&1 != 0 }
+	// the contour is started at an on-curve point, which is implied
+	// between two off-curve ones if there are none
+	var start f32.Vec2
+	first := -1
+	for i, p := range ps {
+		if onCurve(p) {
+			start, first = vec(p), i
+			break
+		}
+	}
+	if first < 0 {
+		start, first = mid(vec(ps[len(ps)-1]), vec(ps[0])), 0
+	} else {
+		first++
+	}
+	poly := []f32.Vec2{start}
+	last := start
+	var ctrl *f32.Vec2
+	for i := 0; i < len(ps); i++ {
+		p := ps[(first+i)%len(ps)]
+		v := vec(p)
+		if onCurve(p) {
+			if ctrl != nil {
+				poly = appendQuad(poly, last, *ctrl, v)
+				ctrl = nil
+			} else {
+				poly = append(poly, v)
+			}
+			last = v
+			continue
+		}
+		if ctrl != nil {
+			m := mid(*ctrl, v)
+			poly = appendQuad(poly, last, *ctrl, m)
+			last = m
+		}
+		ctrl = &v
+	}
+	if ctrl != nil {
+		poly = appendQuad(poly, last, *ctrl, start)
+	}
+	// the contour comes back around to where it started
+	if len(poly) > 1 && poly[len(poly)-1] == start {
+		poly = poly[:len(poly)-1]
+	}
+	return poly
+}
+
+// appendQuad appends the points of a quadratic curve from a to c, but not a
+// itself, to poly.
+func appendQuad(poly []f32.Vec2, a, b, c f32.Vec2) []f32.Vec2 {
+	dx, dy := c[0]-a[0], c[1]-a[1]
+	n := max(int(math.Sqrt(float64(dx*dx+dy*dy))/3), 2)
+	for i := 1; i <= n; i++ {
+		t := float32(i) / float32(n)
+		u := 1 - t
+		poly = append(poly, f32.Vec2{
+			u*u*a[0] + 2*u*t*b[0] + t*t*c[0],
+			u*u*a[1] + 2*u*t*b[1] + t*t*c[1],
+		})
+	}
+	return poly
+}
+
+// strokeContours adds a stroke w pixels either side of each contour to z,
+// made of a quadrilateral for each edge and a join at each corner. Every
+// shape is added with the same winding so that they overlap without
+// cancelling out.
+func strokeContours(z *vector.Rasterizer, contours [][]f32.Vec2, origin f32.Vec2, w float32, join Join) {
+	add := func(ps ...f32.Vec2) {
+		var area float32
+		for i, p := range ps {
+			q := ps[(i+1)%len(ps)]
+			area += p[0]*q[1] - q[0]*p[1]
+		}
+		if area < 0 {
+			for i, j := 0, len(ps)-1; i < j; i, j = i+1, j-1 {
+				ps[i], ps[j] = ps[j], ps[i]
+			}
+		}
+		z.MoveTo(ps[0][0]+origin[0], ps[0][1]+origin[1])
+		for _, p := range ps[1:] {
+			z.LineTo(p[0]+origin[0], p[1]+origin[1])
+		}
+		z.ClosePath()
+	}
+	// normal returns the normal of the edge from a to b, w long
+	normal := func(a, b f32.Vec2) (f32.Vec2, bool) {
+		dx, dy := b[0]-a[0], b[1]-a[1]
+		l := float32(math.Sqrt(float64(dx*dx + dy*dy)))
+		if l == 0 {
+			return f32.Vec2{}, false
+		}
+		return f32.Vec2{-dy / l * w, dx / l * w}, true
+	}
+	offset := func(p, n f32.Vec2, s float32) f32.Vec2 {
+		return f32.Vec2{p[0] + n[0]*s, p[1] + n[1]*s}
+	}
+	for _, c := range contours {
+		for i, a := range c {
+			b := c[(i+1)%len(c)]
+			n1, ok := normal(a, b)
+			if !ok {
+				continue
+			}
+			add(offset(a, n1, 1), offset(b, n1, 1), offset(b, n1, -1), offset(a, n1, -1))
+
+			// the join at b, between this edge and the next one
+			n2, ok := normal(b, c[(i+2)%len(c)])
+			if !ok {
+				continue
+			}
+			switch join {
+			case JoinRound:
+				add(circle(b, w)...)
+			case JoinBevel:
+				add(b, offset(b, n1, 1), offset(b, n2, 1))
+				add(b, offset(b, n1, -1), offset(b, n2, -1))
+			case JoinMiter:
+				// the miter reaches along the bisector of the normals
+				// to where the offset edges meet, which is 1/cos(θ/2)
+				// times the width away for an angle of θ between them
+				m := f32.Vec2{n1[0] + n2[0], n1[1] + n2[1]}
+				// k is 2cos²(θ/2)
+				k := (m[0]*n1[0] + m[1]*n1[1]) / (w * w)
+				if k <= 0 || 2/k > miterLimit*miterLimit {
+					add(b, offset(b, n1, 1), offset(b, n2, 1))
+					add(b, offset(b, n1, -1), offset(b, n2, -1))
+					continue
+				}
+				m = f32.Vec2{m[0] / k, m[1] / k}
+				add(b, offset(b, n1, 1), offset(b, m, 1), offset(b, n2, 1))
+				add(b, offset(b, n1, -1), offset(b, m, -1), offset(b, n2, -1))
+			}
+		}
+	}
+}
+
+// circle returns a polygon approximating a circle of radius r around c.
+func circle(c f32.Vec2, r float32) []f32.Vec2 {
+	n := max(int(r*2), 8)
+	ps := make([]f32.Vec2, n)
+	for i := range ps {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		ps[i] = f32.Vec2{c[0] + r*float32(math.Cos(a)), c[1] + r*float32(math.Sin(a))}
+	}
+	return ps
+}
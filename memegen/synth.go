@@ -0,0 +1,135 @@
+package memegen
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/f32"
+	"golang.org/x/image/math/fixed"
+)
+
+// boldFace synthesizes bold text from a face by smearing each glyph strength
+// pixels to the right.
+type boldFace struct {
+	font.Face
+	strength int
+}
+
+func (f *boldFace) Glyph(dot fixed.Point26_6, r rune) (
+	dr image.Rectangle, mask image.Image, maskp image.Point,
+	advance fixed.Int26_6, ok bool) {
+	dr, mask, maskp, advance, ok = f.Face.Glyph(dot, r)
+	advance += fixed.I(f.strength)
+	if !ok || dr.Empty() {
+		return dr, mask, maskp, advance, ok
+	}
+	m := image.NewAlpha(image.Rect(dr.Min.X, dr.Min.Y, dr.Max.X+f.strength, dr.Max.Y))
+	for i := 0; i <= f.strength; i++ {
+		draw.Draw(m, dr.Add(image.Pt(i, 0)), mask, maskp, draw.Over)
+	}
+	return m.Bounds(), m, m.Bounds().Min, advance, true
+}
+
+func (f *boldFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	b, advance, ok := f.Face.GlyphBounds(r)
+	b.Max.X += fixed.I(f.strength)
+	return b, advance + fixed.I(f.strength), ok
+}
+
+func (f *boldFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	advance, ok := f.Face.GlyphAdvance(r)
+	return advance + fixed.I(f.strength), ok
+}
+
+// outline returns the outline of the glyph of r along with a copy of it
+// strength pixels to the right, whose strokes cover the smeared glyph.
+func (f *boldFace) outline(r rune) [][]f32.Vec2 {
+	o, ok := f.Face.(outliner)
+	if !ok {
+		return nil
+	}
+	contours := o.outline(r)
+	for _, c := range contours {
+		moved := make([]f32.Vec2, len(c))
+		for i, p := range c {
+			moved[i] = f32.Vec2{p[0] + float32(f.strength), p[1]}
+		}
+		contours = append(contours, moved)
+	}
+	return contours
+}
+
+// italicSlant is how far synthesized italics lean to the right for each
+// pixel above the baseline.
+const italicSlant = 0.2
+
+// italicFace synthesizes italics from a face by slanting its glyphs.
+type italicFace struct {
+	font.Face
+}
+
+func (f *italicFace) Glyph(dot fixed.Point26_6, r rune) (
+	dr image.Rectangle, mask image.Image, maskp image.Point,
+	advance fixed.Int26_6, ok bool) {
+	dr, mask, maskp, advance, ok = f.Face.Glyph(dot, r)
+	if !ok || dr.Empty() {
+		return dr, mask, maskp, advance, ok
+	}
+	baseline := float64(dot.Y) / 64
+	shift := func(y int) float64 {
+		return italicSlant * (baseline - float64(y) - 0.5)
+	}
+	out := image.Rect(dr.Min.X+int(math.Floor(shift(dr.Max.Y-1))), dr.Min.Y,
+		dr.Max.X+int(math.Ceil(shift(dr.Min.Y)))+1, dr.Max.Y)
+	m := image.NewAlpha(out)
+	// each row is moved by its shift, spreading pixels over the two they
+	// land between
+	add := func(x, y int, a float64) {
+		i := m.PixOffset(x, y)
+		m.Pix[i] = uint8(min(float64(m.Pix[i])+a, 255))
+	}
+	for y := dr.Min.Y; y < dr.Max.Y; y++ {
+		s := shift(y)
+		whole, frac := math.Floor(s), s-math.Floor(s)
+		for x := dr.Min.X; x < dr.Max.X; x++ {
+			p := maskp.Add(image.Pt(x, y).Sub(dr.Min))
+			a := float64(color.AlphaModel.Convert(mask.At(p.X, p.Y)).(color.Alpha).A)
+			if a == 0 {
+				continue
+			}
+			nx := x + int(whole)
+			add(nx, y, a*(1-frac))
+			add(nx+1, y, a*frac)
+		}
+	}
+	return out, m, out.Min, advance, true
+}
+
+func (f *italicFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	b, advance, ok := f.Face.GlyphBounds(r)
+	slant := func(y fixed.Int26_6) fixed.Int26_6 {
+		return fixed.Int26_6(float64(y) * italicSlant)
+	}
+	b.Min.X -= slant(max(b.Max.Y, 0))
+	b.Max.X += slant(max(-b.Min.Y, 0))
+	return b, advance, ok
+}
+
+func (f *italicFace) outline(r rune) [][]f32.Vec2 {
+	o, ok := f.Face.(outliner)
+	if !ok {
+		return nil
+	}
+	var contours [][]f32.Vec2
+	for _, c := range o.outline(r) {
+		slanted := make([]f32.Vec2, len(c))
+		for i, p := range c {
+			slanted[i] = f32.Vec2{p[0] - p[1]*italicSlant, p[1]}
+		}
+		contours = append(contours, slanted)
+	}
+	return contours
+}
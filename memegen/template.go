@@ -0,0 +1,237 @@
+package memegen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/pelletier/go-toml"
+)
+
+// Template is a meme template: an image with boxes text is put into.
+type Template struct {
+	Name        string      `toml:"-" json:"-"`
+	Description string      `toml:"description" json:"description"`
+	Image       image.Image `toml:"-" json:"-"`
+	Boxes       []TextBox   `toml:"box" json:"boxes"`
+
+	// ImagePath is the path of the image of the template, relative to its
+	// manifest.
+	ImagePath string `toml:"image" json:"image"`
+}
+
+// TextBox is a box of a Template which text is fit into.
+type TextBox struct {
+	// X, Y, W and H are the rectangle of the box in pixels of the template
+	// image.
+	X int `toml:"x" json:"x"`
+	Y int `toml:"y" json:"y"`
+	W int `toml:"w" json:"w"`
+	H int `toml:"h" json:"h"`
+	// Font is one of "impact", "caption" or "times". It defaults to
+	// "impact".
+	Font string `toml:"font" json:"font"`
+	// Color is the hex RGB colour of the text. It defaults to white.
+	Color string `toml:"color" json:"color"`
+	// Outline is the hex RGB colour of the outline of the text. If empty,
+	// the text has no outline.
+	Outline string `toml:"outline" json:"outline"`
+	// OutlineWidth is the width of the outline in pixels. It defaults to a
+	// sixteenth of the height of the text.
+	OutlineWidth int `toml:"outline-width" json:"outline-width"`
+	// Join is how the corners of the outline are drawn: "round", "miter"
+	// or "bevel". It defaults to "round".
+	Join string `toml:"join" json:"join"`
+	// Shadow is the hex RGB colour of the drop shadow of the text. If
+	// empty, the text has no shadow.
+	Shadow string `toml:"shadow" json:"shadow"`
+	// ShadowOffset is how many pixels right of and below the text its
+	// shadow is, or left of and above it if negative. It defaults to a
+	// twentieth of the height of the text.
+	ShadowOffset int `toml:"shadow-offset" json:"shadow-offset"`
+	// ShadowBlur is how blurry the shadow is.
+	ShadowBlur int `toml:"shadow-blur" json:"shadow-blur"`
+	// Align is one of "left", "center" or "right". It defaults to
+	// "center".
+	Align string `toml:"align" json:"align"`
+	// Rotation is how many degrees the text is rotated clockwise around
+	// the centre of the box.
+	Rotation int `toml:"rotation" json:"rotation"`
+}
+
+// LoadTemplates loads the templates in fsys. Each template has a manifest
+// named after it, either TOML ending in .toml or JSON ending in .json, in the
+// root of fsys.
+func LoadTemplates(fsys fs.FS) (map[string]*Template, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	templates := make(map[string]*Template)
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".toml" && ext != ".json") {
+			continue
+		}
+		t, err := loadTemplate(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("loading template %s: %w", entry.Name(), err)
+		}
+		if _, ok := templates[t.Name]; ok {
+			return nil, fmt.Errorf("template %s defined more than once", t.Name)
+		}
+		templates[t.Name] = t
+	}
+	return templates, nil
+}
+
+func loadTemplate(fsys fs.FS, manifest string) (*Template, error) {
+	data, err := fs.ReadFile(fsys, manifest)
+	if err != nil {
+		return nil, err
+	}
+	t := new(Template)
+	if path.Ext(manifest) == ".json" {
+		err = json.Unmarshal(data, t)
+	} else {
+		err = toml.Unmarshal(data, t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.Name = strings.TrimSuffix(manifest, path.Ext(manifest))
+	if t.ImagePath == "" {
+		return nil, errors.New("no image given")
+	}
+	f, err := fsys.Open(t.ImagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if t.Image, _, err = image.Decode(f); err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	if len(t.Boxes) == 0 {
+		return nil, errors.New("no text boxes given")
+	}
+	for i, box := range t.Boxes {
+		if err = box.validate(); err != nil {
+			return nil, fmt.Errorf("text box %d: %w", i+1, err)
+		}
+	}
+	return t, nil
+}
+
+func (b TextBox) validate() error {
+	if b.W <= 0 || b.H <= 0 {
+		return errors.New("size must be positive")
+	}
+	if _, ok := fontNamed(b.font()); !ok {
+		return fmt.Errorf("unknown font %q", b.Font)
+	}
+	for _, c := range []string{b.Color, b.Outline, b.Shadow} {
+		if _, err := parseColor(c); c != "" && err != nil {
+			return err
+		}
+	}
+	if _, ok := parseAlignment(b.Align); !ok {
+		return fmt.Errorf("unknown alignment %q", b.Align)
+	}
+	if _, ok := parseJoin(b.Join); !ok {
+		return fmt.Errorf("unknown join %q", b.Join)
+	}
+	if b.OutlineWidth < 0 || b.ShadowBlur < 0 {
+		return errors.New("outline width and shadow blur can't be negative")
+	}
+	return nil
+}
+
+func (b TextBox) font() string {
+	if b.Font == "" {
+		return "impact"
+	}
+	return b.Font
+}
+
+// parseColor parses a hex RGB colour like "ff0000" or "#ff0000".
+func parseColor(s string) (color.Color, error) {
+	s = strings.TrimPrefix(s, "#")
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s) != 6 {
+		return nil, fmt.Errorf("invalid colour %q", s)
+	}
+	return color.NRGBA{uint8(n >> 16), uint8(n >> 8), uint8(n), 0xff}, nil
+}
+
+// Render draws texts into the boxes of the template, in order. Boxes without
+// text are left empty.
+func (t *Template) Render(texts []string) (image.Image, error) {
+	if len(texts) > len(t.Boxes) {
+		return nil, fmt.Errorf("template %s only has %d text boxes",
+			t.Name, len(t.Boxes))
+	}
+	m := imaging.Clone(t.Image)
+	for i, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		box := t.Boxes[i]
+		img := box.render(text)
+		if box.Rotation != 0 {
+			img = imaging.Rotate(img, float64(-box.Rotation), color.Transparent)
+		}
+		center := image.Pt(box.X+box.W/2, box.Y+box.H/2)
+		r := img.Bounds().Sub(img.Bounds().Min).Add(
+			center.Sub(img.Bounds().Size().Div(2)))
+		draw.Draw(m, r, img, img.Bounds().Min, draw.Over)
+	}
+	return m, nil
+}
+
+// render draws text into an image the size of the box, using the largest
+// font size the text fits at. The image has room around the box for the
+// outline and shadow of the text.
+func (b TextBox) render(text string) *image.NRGBA {
+	fill := color.Color(color.White)
+	if b.Color != "" {
+		fill, _ = parseColor(b.Color)
+	}
+	align, _ := parseAlignment(b.Align)
+	opts := LayoutOptions{Width: b.W, Align: align, Balance: true}
+	l := fitLayout(float64(b.H), b.H, markupText(b.font(), text, opts))
+	faceh := l.face.Metrics().Height.Ceil()
+
+	var o Outline
+	if b.Outline != "" {
+		o.Color, _ = parseColor(b.Outline)
+		o.Width = float64(b.OutlineWidth)
+		if o.Width == 0 {
+			o.Width = max(float64(faceh)/16, 1)
+		}
+		o.Join, _ = parseJoin(b.Join)
+	}
+	if b.Shadow != "" {
+		o.ShadowColor, _ = parseColor(b.Shadow)
+		off := b.ShadowOffset
+		if off == 0 {
+			off = max(faceh/20, 1)
+		}
+		o.ShadowOffset = image.Pt(off, off)
+		o.ShadowBlur = float64(b.ShadowBlur)
+	}
+	margin := int(math.Ceil(o.Width*miterLimit+3*o.ShadowBlur)) + max(o.ShadowOffset.X, -o.ShadowOffset.X)
+	m := image.NewNRGBA(image.Rect(0, 0, b.W, b.H).Inset(-margin))
+	l.DrawOutlined(m, image.Pt(0, (b.H-l.Height)/2), image.NewUniform(fill), o)
+	return m
+}
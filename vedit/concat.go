@@ -0,0 +1,310 @@
+package vedit
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	ff "samhza.com/ffmpeg"
+)
+
+// Clip is an input to Concat.
+type Clip struct {
+	Name string
+	// Start and End trim the clip. An End of zero means the end of the
+	// clip. For images, they only determine how long the image is shown.
+	Start, End float64
+	// Image is true if the clip is a still image.
+	Image bool
+}
+
+// Fit describes how clips with a different aspect ratio from the output are
+// fit into it.
+type Fit int
+
+const (
+	// FitLetterbox scales clips down and pads them with black bars.
+	FitLetterbox Fit = iota
+	// FitBlur scales clips down and pads them with a blurred, zoomed in
+	// copy of the clip.
+	FitBlur
+	// FitStretch stretches clips to the size of the output.
+	FitStretch
+)
+
+// ParseFit parses the name of a Fit.
+func ParseFit(s string) (Fit, error) {
+	switch s {
+	case "letterbox", "pad":
+		return FitLetterbox, nil
+	case "blur":
+		return FitBlur, nil
+	case "stretch":
+		return FitStretch, nil
+	}
+	return 0, fmt.Errorf("unknown fit %q, expected letterbox, blur or stretch", s)
+}
+
+var transitions = map[string]string{
+	"fade":  "fade",
+	"wipe":  "wipeleft",
+	"slide": "slideleft",
+}
+
+// ParseTransition parses the name of a transition between clips, returning
+// the name of the equivalent xfade transition.
+func ParseTransition(s string) (string, error) {
+	if s == "none" || s == "cut" {
+		return "", nil
+	}
+	if t, ok := transitions[s]; ok {
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown transition %q, expected fade, wipe, slide or none", s)
+}
+
+// ParseRange parses a range of the form "start-end", where either side may be
+// omitted. A single number is treated as a duration from the start, so "5"
+// is the same as "0-5".
+func ParseRange(s string) (start, end float64, err error) {
+	from, to, found := strings.Cut(s, "-")
+	if !found {
+		end, err = parseTimestamp(s)
+		return 0, end, err
+	}
+	if from != "" {
+		if start, err = parseTimestamp(from); err != nil {
+			return 0, 0, err
+		}
+	}
+	if to != "" {
+		if end, err = parseTimestamp(to); err != nil {
+			return 0, 0, err
+		}
+		if end <= start {
+			return 0, 0, errors.New("range ends before it starts")
+		}
+	}
+	return start, end, nil
+}
+
+type ConcatOptions struct {
+	// Transition is the xfade transition used between clips. If empty,
+	// clips are cut between.
+	Transition         string
+	TransitionDuration float64
+	Fit                Fit
+	// ImageDuration is how long images are shown for, in seconds, if their
+	// clip doesn't give a range.
+	ImageDuration float64
+	// Width and Height are the size of the output. If zero, the size of the
+	// first clip is used.
+	Width, Height int
+	// Loudness is the loudness in LUFS the audio of each clip is normalized
+	// to, so that they all play at about the same volume. Zero disables
+	// loudness normalization.
+	Loudness float64
+}
+
+type clipInfo struct {
+	width, height int
+	duration      float64
+	hasAudio      bool
+}
+
+func probeClip(name string) (clipInfo, error) {
+	var info clipInfo
+	probed, err := ff.Probe(name)
+	if err != nil {
+		return info, err
+	}
+	for _, stream := range probed.Streams {
+		switch stream.CodecType {
+		case ff.CodecTypeVideo:
+			if info.width != 0 {
+				continue
+			}
+			info.width = stream.Width
+			info.height = stream.Height
+			info.duration, _ = strconv.ParseFloat(stream.Duration, 64)
+		case ff.CodecTypeAudio:
+			info.hasAudio = true
+		}
+	}
+	if info.width == 0 {
+		return info, fmt.Errorf("%s has no video", name)
+	}
+	if info.duration == 0 {
+		// streams of containers like WebM and Matroska don't have
+		// durations of their own
+		info.duration = probeFormatDuration(name)
+	}
+	return info, nil
+}
+
+// probeFormatDuration returns the duration of the file at name given by its
+// container, or 0 if it isn't known.
+func probeFormatDuration(name string) float64 {
+	cmd := exec.Command(
+		"ffprobe",
+		"-v", "quiet",
+		"-print_format", "default=noprint_wrappers=1:nokey=1",
+		"-show_entries", "format=duration",
+		name,
+	)
+	b, err := cmd.Output()
+	if err != nil {
+		return 0
+	}
+	d, _ := strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+	return d
+}
+
+// concatFPS is the frame rate clips are converted to, as xfade needs all of
+// its inputs to have the same frame rate.
+const concatFPS = 30
+
+// Concat joins clips together into an mp4 written to the file at out.
+func Concat(clips []Clip, opts ConcatOptions, out string) error {
+	if len(clips) < 2 {
+		return errors.New("need at least 2 clips")
+	}
+	infos := make([]clipInfo, len(clips))
+	for i, clip := range clips {
+		var err error
+		infos[i], err = probeClip(clip.Name)
+		if err != nil {
+			return fmt.Errorf("probing clip %d: %w", i+1, err)
+		}
+	}
+	w, h := infos[0].width&^1, infos[0].height&^1
+	if opts.Width > 0 && opts.Height > 0 {
+		w, h = opts.Width&^1, opts.Height&^1
+	}
+
+	g := new(graph)
+	vs := make([]string, len(clips))
+	as := make([]string, len(clips))
+	durs := make([]float64, len(clips))
+	for i, clip := range clips {
+		if clip.Image {
+			vs[i], as[i], durs[i] = imageClip(g, clip, opts.ImageDuration)
+		} else {
+			vs[i], as[i], durs[i] = videoClip(g, clip, infos[i])
+		}
+		// cutting between clips doesn't need their durations, unless
+		// silence has to be made for them
+		if durs[i] <= 0 && (opts.Transition != "" || !infos[i].hasAudio) {
+			return fmt.Errorf("couldn't determine the duration of clip %d", i+1)
+		}
+		vs[i] = g.filter(fmt.Sprintf("fps=%d,format=yuv420p", concatFPS),
+			fitFrame(g, vs[i], w, h, opts.Fit))
+		if opts.Loudness != 0 && !clip.Image {
+			as[i] = g.filter(fmt.Sprintf("loudnorm=I=%f:TP=-1.5:LRA=11", opts.Loudness), as[i])
+		}
+		as[i] = g.filter("aresample=48000,aformat=channel_layouts=stereo", as[i])
+	}
+
+	var v, a string
+	if opts.Transition == "" {
+		var ins []string
+		for i := range clips {
+			ins = append(ins, vs[i], as[i])
+		}
+		outs := g.filterN(fmt.Sprintf("concat=n=%d:v=1:a=1", len(clips)), 2, ins...)
+		v, a = outs[0], outs[1]
+	} else {
+		d := opts.TransitionDuration
+		if d <= 0 {
+			d = 1
+		}
+		for i, dur := range durs {
+			if dur <= d {
+				return fmt.Errorf("clip %d is too short for a %gs transition", i+1, d)
+			}
+		}
+		v, a = vs[0], as[0]
+		length := durs[0]
+		for i := 1; i < len(clips); i++ {
+			v = g.filter(fmt.Sprintf("xfade=transition=%s:duration=%f:offset=%f",
+				opts.Transition, d, length-d), v, vs[i])
+			a = g.filter(fmt.Sprintf("acrossfade=d=%f", d), a, as[i])
+			length += durs[i] - d
+		}
+	}
+	return g.run(out, []string{"-f", "mp4"}, v, a)
+}
+
+// defaultImageDuration is how long images are shown for in Concat if no
+// duration was given.
+const defaultImageDuration = 3
+
+// imageClip adds an image to the graph as a clip, returning the labels of its
+// video and audio and its duration.
+func imageClip(g *graph, clip Clip, dur float64) (v, a string, d float64) {
+	if clip.End > clip.Start {
+		dur = clip.End - clip.Start
+	}
+	if dur <= 0 {
+		dur = defaultImageDuration
+	}
+	in := g.input(clip.Name, "-loop", "1", "-t", fmt.Sprintf("%f", dur))
+	return stream(in, "v"), silence(g, dur), dur
+}
+
+// videoClip adds a video or GIF to the graph as a clip, returning the labels
+// of its video and audio and its duration. Clips without audio are given
+// silence.
+func videoClip(g *graph, clip Clip, info clipInfo) (v, a string, d float64) {
+	in := g.input(clip.Name)
+	v = stream(in, "v")
+	d = info.duration
+	if clip.End > 0 && (d == 0 || clip.End < d) {
+		d = clip.End
+	}
+	d -= clip.Start
+	var trim []string
+	if clip.Start > 0 {
+		trim = append(trim, fmt.Sprintf("start=%f", clip.Start))
+	}
+	if clip.End > 0 {
+		trim = append(trim, fmt.Sprintf("end=%f", clip.End))
+	}
+	if len(trim) > 0 {
+		v = g.filter("trim="+strings.Join(trim, ":")+",setpts=PTS-STARTPTS", v)
+	}
+	if !info.hasAudio {
+		return v, silence(g, d), d
+	}
+	a = stream(in, "a")
+	if len(trim) > 0 {
+		a = g.filter("atrim="+strings.Join(trim, ":")+",asetpts=PTS-STARTPTS", a)
+	}
+	return v, a, d
+}
+
+// silence adds d seconds of silence to the graph.
+func silence(g *graph, d float64) string {
+	return g.filter(fmt.Sprintf("anullsrc=r=48000:cl=stereo,atrim=duration=%f", d))
+}
+
+// fitFrame adds filters to the graph which fit v into a w by h frame,
+// returning the label of the result.
+func fitFrame(g *graph, v string, w, h int, fit Fit) string {
+	scale := fmt.Sprintf("scale=%d:%d", w, h)
+	switch fit {
+	case FitStretch:
+		return g.filter(scale+",setsar=1", v)
+	case FitBlur:
+		vs := g.filterN("split", 2, v)
+		bg := g.filter(scale+":force_original_aspect_ratio=increase,"+
+			fmt.Sprintf("crop=%d:%d,boxblur=20:5,setsar=1", w, h), vs[0])
+		fg := g.filter(scale+":force_original_aspect_ratio=decrease,setsar=1", vs[1])
+		return g.filter("overlay=(W-w)/2:(H-h)/2", bg, fg)
+	default:
+		return g.filter(scale+":force_original_aspect_ratio=decrease,"+
+			fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1", w, h), v)
+	}
+}
@@ -0,0 +1,95 @@
+package vedit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ff "samhza.com/ffmpeg"
+)
+
+// The effects here are random, but use noise derived from the frame number
+// and a seed instead of ffmpeg's random function, so that the same edit of
+// the same video always looks the same.
+
+// noise returns an ffmpeg expression giving a pseudorandom number between 0
+// and 1 for each value of the expression x. Different values of k give
+// unrelated sequences.
+func noise(x string, seed, k int) string {
+	return fmt.Sprintf("mod(abs(sin((%s)*12.9898+%d*78.233)*43758.5453),1)",
+		x, seed*16+k)
+}
+
+// parseIntensity parses the optional intensity argument of an effect.
+func parseIntensity(arg string) (float64, error) {
+	if arg == "" {
+		return 1, nil
+	}
+	i, err := strconv.ParseFloat(arg, 64)
+	if err == nil && (i <= 0 || i > 10) {
+		err = errors.New("intensity must be between 0 and 10")
+	}
+	return i, err
+}
+
+// shake moves each frame of v by a random amount. It zooms in slightly so
+// that the edges of the frame aren't shown.
+func shake(v ff.Stream, intensity float64, seed int) ff.Stream {
+	margin := 0.02 * intensity
+	keep := fmt.Sprintf("%f", 1-2*margin)
+	v = ff.Filter(v, fmt.Sprintf("crop=w=iw*%s:h=ih*%s:x='(iw-ow)*%s':y='(ih-oh)*%s'",
+		keep, keep, noise("n", seed, 1), noise("n", seed, 2)))
+	return ff.Filter(v, "scale=trunc(iw/"+keep+"/2)*2:trunc(ih/"+keep+"/2)*2")
+}
+
+// zoomshakeFPS is the frame rate of videos with zoomshake applied.
+const zoomshakeFPS = 30
+
+// zoomshake zooms into v in sudden punches which ease back out, like a bass
+// boosted meme. Punches happen about twice a second, at slightly random
+// times.
+func zoomshake(v ff.Stream, w, h int, intensity float64, seed int) ff.Stream {
+	// t is the time since the last punch, each half second long beat
+	// being offset by up to a tenth of a second
+	beat := fmt.Sprintf("floor(on/%d)", zoomshakeFPS/2)
+	t := fmt.Sprintf("(mod(on,%d)/%d-%s*0.1)", zoomshakeFPS/2, zoomshakeFPS, noise(beat, seed, 3))
+	zoom := fmt.Sprintf("1+%f*if(gte(%s,0),exp(-%s*12),0)", 0.15*intensity, t, t)
+	v = ff.Filter(v, fmt.Sprintf("fps=%d", zoomshakeFPS))
+	return ff.Filter(v, fmt.Sprintf(
+		"zoompan=z='%s':x='(iw-iw/zoom)/2':y='(ih-ih/zoom)/2':d=1:s=%dx%d:fps=%d",
+		zoom, w&^1, h&^1, zoomshakeFPS))
+}
+
+// glitch shifts the red and blue channels of v apart and displaces random
+// horizontal blocks sideways, changing every frame.
+func glitch(v ff.Stream, intensity float64, seed int) ff.Stream {
+	// block is which of the 24 horizontal blocks a pixel is in, and shift
+	// is how far that block is displaced in the current frame, with about
+	// a fifth of the blocks being displaced
+	block := "floor(Y*24/H)"
+	frameBlock := block + "+N*31"
+	shift := fmt.Sprintf("if(lt(%s,%f),(%s-0.5)*W*%f,0)",
+		noise(frameBlock, seed, 4), 0.2*intensity,
+		noise(frameBlock, seed, 5), 0.3*intensity)
+	rgb := fmt.Sprintf("W*%f*%s", 0.015*intensity, noise("N", seed, 6))
+	channel := func(c, off string) string {
+		return fmt.Sprintf("%s='%s(clip(X+%s%s,0,W-1),Y)'", c, c, shift, off)
+	}
+	return ff.Filter(v, "format=gbrp,geq="+strings.Join([]string{
+		channel("r", "+"+rgb),
+		channel("g", ""),
+		channel("b", "-"+rgb),
+	}, ":")+",format=yuv420p")
+}
+
+// datamosh blends each frame of v with the frames before it, smearing moving
+// parts of the video like a datamoshed video.
+func datamosh(v ff.Stream, intensity float64) ff.Stream {
+	frames := int(4*intensity) + 2
+	decay := 1 - 0.04/intensity
+	if decay < 0.5 {
+		decay = 0.5
+	}
+	return ff.Filter(v, fmt.Sprintf("tmix=frames=%d,lagfun=decay=%f", frames, decay))
+}
@@ -0,0 +1,103 @@
+package vedit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"samhza.com/esammy/imagefx"
+)
+
+// filterFrames runs every frame of the video in the file at in through e,
+// writing an mp4 of the result along with the original audio to the file at
+// out. e mustn't change the size of frames.
+func filterFrames(in, out string, e imagefx.Effect) error {
+	info, err := probeClip(in)
+	if err != nil {
+		return err
+	}
+	rate, err := probeFrameRate(in)
+	if err != nil {
+		return err
+	}
+	decStderr := &bytes.Buffer{}
+	dec := exec.Command("ffmpeg", "-loglevel", "error", "-i", in,
+		"-f", "rawvideo", "-pix_fmt", "rgba", "pipe:1")
+	dec.Stderr = decStderr
+	frames, err := dec.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	encStderr := &bytes.Buffer{}
+	enc := exec.Command("ffmpeg", "-y", "-loglevel", "error",
+		"-f", "rawvideo", "-pix_fmt", "rgba",
+		"-s", fmt.Sprintf("%dx%d", info.width, info.height),
+		"-framerate", rate, "-i", "pipe:0",
+		"-i", in, "-map", "0:v", "-map", "1:a?", "-c:a", "copy",
+		"-pix_fmt", "yuv420p", "-f", "mp4", out)
+	enc.Stderr = encStderr
+	filtered, err := enc.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err = dec.Start(); err != nil {
+		return err
+	}
+	if err = enc.Start(); err != nil {
+		frames.Close()
+		dec.Wait()
+		return err
+	}
+	frame := image.NewNRGBA(image.Rect(0, 0, info.width, info.height))
+	var writeErr bool
+	for {
+		if _, err = io.ReadFull(frames, frame.Pix); err != nil {
+			break
+		}
+		res := imaging.Clone(e.Apply(frame))
+		if res.Rect != frame.Rect {
+			err = errors.New("effect changed the size of the video")
+			break
+		}
+		if _, err = filtered.Write(res.Pix); err != nil {
+			writeErr = true
+			break
+		}
+	}
+	filtered.Close()
+	frames.Close()
+	encErr := ffmpegError(enc.Wait(), encStderr)
+	decErr := ffmpegError(dec.Wait(), decStderr)
+	if writeErr && encErr != nil {
+		// the encoder quitting is why writing to it failed
+		return encErr
+	}
+	if err != io.EOF {
+		return err
+	}
+	if decErr != nil {
+		return decErr
+	}
+	return encErr
+}
+
+// probeFrameRate returns the average frame rate of the first video stream of
+// the file at name, as a fraction like "30000/1001".
+func probeFrameRate(name string) (string, error) {
+	out, err := exec.Command("ffprobe", "-v", "quiet", "-select_streams", "v:0",
+		"-show_entries", "stream=avg_frame_rate",
+		"-of", "default=noprint_wrappers=1:nokey=1", name).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to execute FFprobe: %w", err)
+	}
+	rate := strings.TrimSpace(string(out))
+	if rate == "" || strings.HasPrefix(rate, "0/") {
+		return "", errors.New("couldn't determine the frame rate")
+	}
+	return rate, nil
+}
@@ -0,0 +1,78 @@
+package vedit
+
+import (
+	"bytes"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// graph builds a filtergraph for a raw ffmpeg command. It's used for filters
+// that take more than two inputs or produce more than one output, which the
+// ffmpeg package can't express.
+type graph struct {
+	inputs  [][]string
+	filters []string
+	labels  int
+}
+
+// input adds an input to the command and returns its index, which can be
+// passed to stream.
+func (g *graph) input(name string, opts ...string) int {
+	args := append(opts[:len(opts):len(opts)], "-i", name)
+	g.inputs = append(g.inputs, args)
+	return len(g.inputs) - 1
+}
+
+// stream returns the label of the first stream of type typ ("v" or "a") of
+// the input at index i.
+func stream(i int, typ string) string {
+	return strconv.Itoa(i) + ":" + typ + ":0"
+}
+
+// filter adds a filter with the given inputs, returning the label of its
+// output.
+func (g *graph) filter(filter string, ins ...string) string {
+	return g.filterN(filter, 1, ins...)[0]
+}
+
+// filterN adds a filter with the given inputs and n outputs, returning the
+// labels of its outputs.
+func (g *graph) filterN(filter string, n int, ins ...string) []string {
+	var sb strings.Builder
+	for _, in := range ins {
+		sb.WriteString("[" + in + "]")
+	}
+	sb.WriteString(filter)
+	outs := make([]string, n)
+	for i := range outs {
+		g.labels++
+		outs[i] = "s" + strconv.Itoa(g.labels)
+		sb.WriteString("[" + outs[i] + "]")
+	}
+	g.filters = append(g.filters, sb.String())
+	return outs
+}
+
+// run runs ffmpeg, writing the given streams to the file at path.
+func (g *graph) run(path string, outopts []string, streams ...string) error {
+	args := []string{"-y", "-loglevel", "error"}
+	for _, in := range g.inputs {
+		args = append(args, in...)
+	}
+	if len(g.filters) > 0 {
+		args = append(args, "-filter_complex", strings.Join(g.filters, ";"))
+	}
+	for _, s := range streams {
+		if !strings.Contains(s, ":") {
+			s = "[" + s + "]"
+		}
+		args = append(args, "-map", s)
+	}
+	args = append(args, outopts...)
+	args = append(args, path)
+	cmd := exec.Command("ffmpeg", args...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	return runFFmpeg(cmd, stderr)
+}
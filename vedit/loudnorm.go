@@ -0,0 +1,99 @@
+package vedit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	ff "samhza.com/ffmpeg"
+)
+
+// ErrNoAudio is returned by Normalize when there is no audio to normalize.
+var ErrNoAudio = errors.New("no audio to normalize")
+
+// loudnorm holds the measurements printed by the first pass of the loudnorm
+// filter.
+type loudnorm struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// Normalize normalizes the loudness of the audio in the file at in to target
+// LUFS using two-pass EBU R128 loudness normalization, writing the result to
+// out. Video is copied as is. The output format is guessed from the extension
+// of out.
+func Normalize(in, out string, target float64) error {
+	probed, err := ff.Probe(in)
+	if err != nil {
+		return err
+	}
+	var hasAudio bool
+	for _, stream := range probed.Streams {
+		if stream.CodecType == ff.CodecTypeAudio {
+			hasAudio = true
+			break
+		}
+	}
+	if !hasAudio {
+		return ErrNoAudio
+	}
+
+	params := fmt.Sprintf("loudnorm=I=%f:TP=-1.5:LRA=11", target)
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-nostats",
+		"-i", in, "-vn", "-af", params+":print_format=json",
+		"-f", "null", "-")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err = runFFmpeg(cmd, stderr); err != nil {
+		return fmt.Errorf("measuring loudness: %w", err)
+	}
+	// the measurements are the last thing printed
+	i := strings.LastIndexByte(stderr.String(), '{')
+	if i == -1 {
+		return errors.New("measuring loudness: no measurements printed")
+	}
+	var m loudnorm
+	if err = json.Unmarshal(stderr.Bytes()[i:], &m); err != nil {
+		return fmt.Errorf("measuring loudness: %w", err)
+	}
+	if m.InputI == "-inf" {
+		return ErrNoAudio
+	}
+
+	params += fmt.Sprintf(":measured_I=%s:measured_TP=%s:measured_LRA=%s"+
+		":measured_thresh=%s:offset=%s:linear=true",
+		m.InputI, m.InputTP, m.InputLRA, m.InputThresh, m.TargetOffset)
+	cmd = exec.Command("ffmpeg", "-y", "-loglevel", "error",
+		"-i", in, "-map", "0:v?", "-map", "0:a:0",
+		"-c:v", "copy", "-af", params, "-ar", "48000", out)
+	stderr.Reset()
+	cmd.Stderr = stderr
+	if err = runFFmpeg(cmd, stderr); err != nil {
+		return fmt.Errorf("normalizing loudness: %w", err)
+	}
+	return nil
+}
+
+func runFFmpeg(cmd *exec.Cmd, stderr *bytes.Buffer) error {
+	return ffmpegError(cmd.Run(), stderr)
+}
+
+// ffmpegError adds what FFmpeg wrote to stderr to err if FFmpeg exited
+// unsuccessfully.
+func ffmpegError(err error, stderr *bytes.Buffer) error {
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			return fmt.Errorf("exit status %d: %s",
+				exitError.ExitCode(), string(stderr.String()))
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package vedit
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	ff "samhza.com/ffmpeg"
+)
+
+type duckMode int
+
+const (
+	duckNone duckMode = iota
+	// duckOrig lowers the original audio while the music is playing.
+	duckOrig
+	// duckMusic lowers the music while there is original audio.
+	duckMusic
+)
+
+func parseDuck(arg string) (duckMode, error) {
+	switch arg {
+	case "", "orig", "original":
+		return duckOrig, nil
+	case "music":
+		return duckMusic, nil
+	}
+	return duckNone, fmt.Errorf("unknown duck mode %q, expected orig or music", arg)
+}
+
+// sidechain is the sidechaincompress filter used for ducking.
+const sidechain = "sidechaincompress=threshold=0.03:ratio=10:attack=20:release=400"
+
+// mixMusic mixes music into orig as described by arg. orig is rendered to a
+// temporary file first, as ducking needs filters which take multiple inputs.
+// The returned file has the same duration as orig, and should be removed by
+// the caller.
+func mixMusic(orig ff.Stream, music string, arg Arguments) (*os.File, error) {
+	pre, err := os.CreateTemp("", "esammy.*.wav")
+	if err != nil {
+		return nil, err
+	}
+	pre.Close()
+	defer os.Remove(pre.Name())
+	fcmd := new(ff.Cmd)
+	fcmd.AddOutput(pre.Name(), []string{"-y", "-f", "wav"}, orig)
+	cmd := fcmd.Cmd()
+	cmd.Args = append(cmd.Args, "-loglevel", "error")
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("rendering audio: %w", err)
+	}
+	dur, err := probeDuration(pre.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	g := new(graph)
+	o := stream(g.input(pre.Name()), "a")
+	musopts := []string{"-ss", fmt.Sprintf("%f", arg.musicskip)}
+	if arg.musicloop {
+		musopts = append(musopts, "-stream_loop", "-1")
+	} else {
+		musopts = append(musopts, "-t", "600") // lets limit it to 10 minutes
+	}
+	m := stream(g.input(music, musopts...), "a")
+
+	if arg.origvolume != nil {
+		o = g.filter(fmt.Sprintf("volume=%f", *arg.origvolume), o)
+	}
+	if arg.musicvolume != nil {
+		m = g.filter(fmt.Sprintf("volume=%f", *arg.musicvolume), m)
+	}
+	if arg.musicfade > 0 {
+		m = g.filter(fmt.Sprintf("afade=t=in:d=%f", arg.musicfade), m)
+		if end := dur - arg.musicdelay - arg.musicfade; end > 0 {
+			m = g.filter(fmt.Sprintf("afade=t=out:st=%f:d=%f", end, arg.musicfade), m)
+		}
+	}
+	if arg.musicdelay > 0 {
+		ms := strconv.Itoa(int(arg.musicdelay * 1000))
+		m = g.filter("adelay="+ms+":all=1", m)
+	}
+	switch arg.duck {
+	case duckOrig:
+		ms := g.filterN("asplit", 2, m)
+		m = ms[0]
+		o = g.filter(sidechain, o, ms[1])
+	case duckMusic:
+		origs := g.filterN("asplit", 2, o)
+		o = origs[0]
+		m = g.filter(sidechain, m, origs[1])
+	}
+	mixed := g.filter("amix=inputs=2:duration=first:normalize=0", o, m)
+
+	out, err := os.CreateTemp("", "esammy.*.wav")
+	if err != nil {
+		return nil, err
+	}
+	if err = g.run(out.Name(), []string{"-f", "wav"}, mixed); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return nil, fmt.Errorf("mixing music: %w", err)
+	}
+	return out, nil
+}
+
+// probeDuration returns the duration of the first stream in the file at path
+// in seconds.
+func probeDuration(path string) (float64, error) {
+	probed, err := ff.Probe(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, stream := range probed.Streams {
+		if stream.Duration == "" {
+			continue
+		}
+		return strconv.ParseFloat(stream.Duration, 64)
+	}
+	return 0, fmt.Errorf("couldn't find duration of %s", path)
+}
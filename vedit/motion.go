@@ -0,0 +1,121 @@
+package vedit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ff "samhza.com/ffmpeg"
+)
+
+// motion is a zoom or pan over the video, like a Ken Burns effect.
+type motion struct {
+	kind string // "zoom", "pan" or "kenburns"
+	// dir is "in" or "out" for zooms and "left" or "right" for pans.
+	dir string
+	// dur is how long the motion takes in seconds. If zero, it lasts for
+	// the whole video.
+	dur    float64
+	easing string
+}
+
+// easings are ffmpeg expressions which map P, the linear progress of a
+// motion from 0 to 1, onto the eased progress.
+var easings = map[string]string{
+	"linear":    "P",
+	"easein":    "P*P",
+	"easeout":   "1-(1-P)*(1-P)",
+	"easeinout": "P*P*(3-2*P)",
+}
+
+// parseMotion parses the arguments of a zoom, pan or kenburns edit: a
+// direction, if the edit has one, then an optional duration and easing.
+func parseMotion(kind, args string) (*motion, error) {
+	m := &motion{kind: kind, easing: "easeinout"}
+	fields := strings.Fields(args)
+	switch kind {
+	case "zoom", "pan":
+		if len(fields) == 0 {
+			return nil, errors.New("missing direction")
+		}
+		m.dir, fields = fields[0], fields[1:]
+		if kind == "zoom" && m.dir != "in" && m.dir != "out" {
+			return nil, errors.New("direction must be in or out")
+		}
+		if kind == "pan" && m.dir != "left" && m.dir != "right" {
+			return nil, errors.New("direction must be left or right")
+		}
+	}
+	for _, f := range fields {
+		if _, ok := easings[f]; ok {
+			m.easing = f
+			continue
+		}
+		dur, err := strconv.ParseFloat(f, 64)
+		if err != nil || dur <= 0 {
+			return nil, fmt.Errorf("invalid duration or easing %q", f)
+		}
+		m.dur = dur
+	}
+	return m, nil
+}
+
+const (
+	// motionFPS is the frame rate of videos with motion applied.
+	motionFPS = 30
+	// motionZoom is how far in zooms go, and how far in the frame is
+	// zoomed for pans.
+	motionZoom = 1.3
+	// motionUpscale is how many times larger still images are scaled
+	// before being moved, up to maxMotionSize pixels along their longest
+	// side.
+	motionUpscale = 4
+	maxMotionSize = 4096
+)
+
+// apply adds the motion to v, a w by h video. dur is the duration of the video,
+// used if the motion has no duration of its own. Small still images are
+// upscaled first, to make the motion smoother.
+func (m *motion) apply(v ff.Stream, w, h int, dur float64, still bool) ff.Stream {
+	if m.dur > 0 {
+		dur = m.dur
+	}
+	frames := dur * motionFPS
+	// the expressions are quoted, so commas in them don't need escaping
+	progress := fmt.Sprintf("min(on/%f,1)", frames)
+	e := "(" + strings.ReplaceAll(easings[m.easing], "P", progress) + ")"
+	z := strconv.FormatFloat(motionZoom, 'f', -1, 64)
+	centerX, centerY := "(iw-iw/zoom)/2", "(ih-ih/zoom)/2"
+	var zoom, x, y string
+	switch m.kind {
+	case "zoom":
+		zoom = "1+(" + z + "-1)*" + e
+		if m.dir == "out" {
+			zoom = z + "-(" + z + "-1)*" + e
+		}
+		x, y = centerX, centerY
+	case "pan":
+		zoom = z
+		x = "(iw-iw/zoom)*" + e
+		if m.dir == "left" {
+			x = "(iw-iw/zoom)*(1-" + e + ")"
+		}
+		y = centerY
+	case "kenburns":
+		zoom = "1+(" + z + "-1)*" + e
+		x, y = "(iw-iw/zoom)*"+e, "(ih-ih/zoom)*"+e
+	}
+	v = ff.Filter(v, fmt.Sprintf("fps=%d", motionFPS))
+	if still {
+		// zoompan crops whole pixels, so small images are upscaled to move
+		// smoothly, while big ones already do
+		scale := min(motionUpscale, float64(maxMotionSize)/float64(max(w, h)))
+		if scale > 1 {
+			v = ff.Filter(v, fmt.Sprintf("scale=%d:%d",
+				int(float64(w)*scale)&^1, int(float64(h)*scale)&^1))
+		}
+	}
+	return ff.Filter(v, fmt.Sprintf("zoompan=z='%s':x='%s':y='%s':d=1:s=%dx%d:fps=%d",
+		zoom, x, y, w&^1, h&^1, motionFPS))
+}
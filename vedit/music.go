@@ -0,0 +1,335 @@
+package vedit
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kkdai/youtube/v2"
+	"samhza.com/ytsearch"
+)
+
+// MusicResolver turns the argument of the music command into something that
+// can be given to ffmpeg as an input, either a URL or a path to a local file.
+type MusicResolver interface {
+	ResolveMusic(query string) (string, error)
+}
+
+// ChainResolver tries each of its resolvers in order, returning the result of
+// the first one that succeeds.
+type ChainResolver []MusicResolver
+
+func (c ChainResolver) ResolveMusic(query string) (string, error) {
+	if len(c) == 0 {
+		return "", errors.New("no music resolvers configured")
+	}
+	var errs []error
+	for _, r := range c {
+		music, err := r.ResolveMusic(query)
+		if err == nil {
+			return music, nil
+		}
+		errs = append(errs, err)
+	}
+	return "", errors.Join(errs...)
+}
+
+// YTDLPResolver resolves music using yt-dlp. Queries which aren't URLs are
+// searched for on YouTube.
+type YTDLPResolver struct{}
+
+func (YTDLPResolver) ResolveMusic(query string) (string, error) {
+	if !isURL(query) {
+		query = "ytsearch1:" + query
+	}
+	cmd := exec.Command(
+		"yt-dlp",
+		"--no-playlist",
+		"--get-url",
+		"-f", "bestaudio/best",
+		"--match-filter", "!is_live",
+		"--",
+		query)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			return "", fmt.Errorf("yt-dlp: %s", strings.TrimSpace(stderr.String()))
+		}
+		return "", fmt.Errorf("yt-dlp: %w", err)
+	}
+	music, _, _ := strings.Cut(string(out), "\n")
+	if music == "" {
+		return "", errors.New("yt-dlp: no results")
+	}
+	return music, nil
+}
+
+// YouTubeResolver resolves music by fetching YouTube videos directly, searching
+// for the query if it isn't a video URL or ID.
+type YouTubeResolver struct{}
+
+func (YouTubeResolver) ResolveMusic(query string) (string, error) {
+	ytc := new(youtube.Client)
+	vid, err := ytc.GetVideo(query)
+	if err != nil {
+		results, err := ytsearch.Search(query)
+		if err != nil {
+			return "", fmt.Errorf("searching: %w", err)
+		}
+		if len(results) == 0 {
+			return "", fmt.Errorf("no search results")
+		}
+		vid, err = ytc.GetVideo(results[0].ID)
+		if err != nil {
+			return "", fmt.Errorf("fetching video: %w", err)
+		}
+	}
+	formats := vid.Formats.Type("audio")
+	if len(formats) == 0 {
+		return "", fmt.Errorf("audio stream for video not found")
+	}
+	formats.Sort()
+	return ytc.GetStreamURL(vid, &formats[0])
+}
+
+// LibraryResolver resolves music from a directory of audio files. Files are
+// matched against the words of the query using their artist and title tags as
+// well as their file names. The directory is indexed on first use.
+type LibraryResolver struct {
+	Dir string
+
+	once   sync.Once
+	tracks []libraryTrack
+	err    error
+}
+
+type libraryTrack struct {
+	path string
+	// name is the lowercased artist, title and file name of the track.
+	name string
+}
+
+func (l *LibraryResolver) ResolveMusic(query string) (string, error) {
+	l.once.Do(func() {
+		l.tracks, l.err = indexLibrary(l.Dir)
+	})
+	if l.err != nil {
+		return "", fmt.Errorf("indexing music library: %w", l.err)
+	}
+	if isURL(query) {
+		return "", errors.New("music library can't resolve URLs")
+	}
+	track, ok := matchTrack(l.tracks, query)
+	if !ok {
+		return "", fmt.Errorf("no track in music library matching %q", query)
+	}
+	return track.path, nil
+}
+
+var audioExts = map[string]bool{
+	".mp3": true, ".m4a": true, ".ogg": true, ".opus": true,
+	".flac": true, ".wav": true, ".aac": true, ".webm": true,
+}
+
+func indexLibrary(dir string) ([]libraryTrack, error) {
+	var tracks []libraryTrack
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !audioExts[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		name := strings.TrimSuffix(d.Name(), filepath.Ext(path))
+		// tags are optional, a file that can't be probed is still
+		// searchable by name
+		if tags, err := probeTags(path); err == nil {
+			name = tags["artist"] + " " + tags["title"] + " " + name
+		}
+		tracks = append(tracks, libraryTrack{
+			path: path,
+			name: strings.ToLower(name),
+		})
+		return nil
+	})
+	return tracks, err
+}
+
+// matchTrack returns the track which contains the most words of the query,
+// preferring tracks with shorter names when there is a tie.
+func matchTrack(tracks []libraryTrack, query string) (libraryTrack, bool) {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return libraryTrack{}, false
+	}
+	type match struct {
+		track libraryTrack
+		score int
+	}
+	var matches []match
+	for _, t := range tracks {
+		var score int
+		for _, w := range words {
+			if strings.Contains(t.name, w) {
+				score++
+			}
+		}
+		if score > 0 {
+			matches = append(matches, match{t, score})
+		}
+	}
+	if len(matches) == 0 {
+		return libraryTrack{}, false
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return len(matches[i].track.name) < len(matches[j].track.name)
+	})
+	return matches[0].track, true
+}
+
+func probeTags(path string) (map[string]string, error) {
+	cmd := exec.Command(
+		"ffprobe",
+		"-v", "quiet",
+		"-print_format", "default=noprint_wrappers=1",
+		"-show_entries", "format_tags=artist,title",
+		path,
+	)
+	b, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute FFprobe: %w", err)
+	}
+	tags := make(map[string]string)
+	for _, line := range strings.Split(string(b), "\n") {
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.ToLower(strings.TrimPrefix(k, "TAG:"))] = v
+	}
+	return tags, nil
+}
+
+// maxCachedMusicSize is the largest file CachedResolver will store on disk.
+const maxCachedMusicSize = 100 << 20
+
+// CachedResolver downloads music resolved by another resolver into a
+// directory, so that later requests for the same music don't have to resolve
+// and download it again.
+type CachedResolver struct {
+	Resolver MusicResolver
+	Dir      string
+	Client   *http.Client
+
+	// mu guards keys, which has a lock for each query being resolved so
+	// that the same music isn't downloaded twice at once, while other
+	// queries aren't held up behind it.
+	mu   sync.Mutex
+	keys map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	// n is how many callers hold or are waiting for the lock
+	n int
+}
+
+// lock locks the key, returning a function which unlocks it.
+func (c *CachedResolver) lock(key string) func() {
+	c.mu.Lock()
+	if c.keys == nil {
+		c.keys = make(map[string]*keyLock)
+	}
+	l, ok := c.keys[key]
+	if !ok {
+		l = new(keyLock)
+		c.keys[key] = l
+	}
+	l.n++
+	c.mu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		c.mu.Lock()
+		if l.n--; l.n == 0 {
+			delete(c.keys, key)
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *CachedResolver) ResolveMusic(query string) (string, error) {
+	sum := sha1.Sum([]byte(query))
+	key := hex.EncodeToString(sum[:])
+	path := filepath.Join(c.Dir, key)
+	defer c.lock(key)()
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	music, err := c.Resolver.ResolveMusic(query)
+	if err != nil {
+		return "", err
+	}
+	if !isURL(music) {
+		return music, nil
+	}
+	if err = c.download(music, path); err != nil {
+		// the music can still be streamed even if it couldn't be cached
+		return music, nil
+	}
+	return path, nil
+}
+
+func (c *CachedResolver) download(music, path string) error {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(music)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	f, err := os.CreateTemp(c.Dir, "*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	lr := &io.LimitedReader{R: resp.Body, N: maxCachedMusicSize + 1}
+	_, err = io.Copy(f, lr)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if lr.N == 0 {
+		return errors.New("music too large to cache")
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
@@ -0,0 +1,99 @@
+package vedit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeResolver struct {
+	music string
+	err   error
+	calls int
+}
+
+func (f *fakeResolver) ResolveMusic(string) (string, error) {
+	f.calls++
+	return f.music, f.err
+}
+
+func TestChainResolver(t *testing.T) {
+	failing := &fakeResolver{err: errors.New("failed")}
+	ok := &fakeResolver{music: "https://example.com/song.opus"}
+	unused := &fakeResolver{music: "unused"}
+	music, err := ChainResolver{failing, ok, unused}.ResolveMusic("song")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if music != ok.music {
+		t.Errorf("got %q, want %q", music, ok.music)
+	}
+	if unused.calls != 0 {
+		t.Error("resolver after a successful one was called")
+	}
+	if _, err = (ChainResolver{failing, failing}).ResolveMusic("song"); err == nil {
+		t.Error("expected error when every resolver fails")
+	}
+}
+
+// blockingResolver blocks resolving "slow" until unblock is closed, sending
+// on entered once it has started to.
+type blockingResolver struct {
+	entered, unblock chan struct{}
+}
+
+func (b blockingResolver) ResolveMusic(query string) (string, error) {
+	if query == "slow" {
+		b.entered <- struct{}{}
+		<-b.unblock
+	}
+	return "/music/" + query, nil
+}
+
+func TestCachedResolverConcurrent(t *testing.T) {
+	block := blockingResolver{make(chan struct{}), make(chan struct{})}
+	defer close(block.unblock)
+	c := &CachedResolver{Resolver: block, Dir: t.TempDir()}
+	go c.ResolveMusic("slow")
+	// the slow query holds its lock from here on
+	<-block.entered
+	done := make(chan string)
+	go func() {
+		music, _ := c.ResolveMusic("fast")
+		done <- music
+	}()
+	select {
+	case music := <-done:
+		if music != "/music/fast" {
+			t.Errorf("got %q", music)
+		}
+	case <-time.After(time.Second):
+		t.Error("resolving was held up by another query")
+	}
+}
+
+func TestMatchTrack(t *testing.T) {
+	tracks := []libraryTrack{
+		{path: "a.mp3", name: "rick astley never gonna give you up extended"},
+		{path: "b.mp3", name: "rick astley never gonna give you up"},
+		{path: "c.mp3", name: "darude sandstorm"},
+	}
+	tests := []struct {
+		query string
+		want  string
+		ok    bool
+	}{
+		{"never gonna", "b.mp3", true},
+		{"Never Gonna Extended", "a.mp3", true},
+		{"sandstorm", "c.mp3", true},
+		{"all star", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		track, ok := matchTrack(tracks, tt.query)
+		if ok != tt.ok || track.path != tt.want {
+			t.Errorf("matchTrack(%q) = %q, %v; want %q, %v",
+				tt.query, track.path, ok, tt.want, tt.ok)
+		}
+	}
+}
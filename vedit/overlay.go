@@ -0,0 +1,186 @@
+package vedit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	ff "samhza.com/ffmpeg"
+)
+
+// Position is where an overlay is placed on its base.
+type Position int
+
+const (
+	PositionBottomRight Position = iota
+	PositionBottomLeft
+	PositionTopRight
+	PositionTopLeft
+	PositionTop
+	PositionBottom
+	PositionLeft
+	PositionRight
+	PositionCenter
+)
+
+var positions = map[string]Position{
+	"bottomright": PositionBottomRight,
+	"bottomleft":  PositionBottomLeft,
+	"topright":    PositionTopRight,
+	"topleft":     PositionTopLeft,
+	"top":         PositionTop,
+	"bottom":      PositionBottom,
+	"left":        PositionLeft,
+	"right":       PositionRight,
+	"center":      PositionCenter,
+}
+
+// ParsePosition parses the name of a Position, like "topleft" or "center".
+func ParsePosition(s string) (Position, bool) {
+	p, ok := positions[s]
+	return p, ok
+}
+
+type OverlayOptions struct {
+	Position Position
+	// Scale is the width of the overlay as a fraction of the width of the
+	// base.
+	Scale float64
+	// KeyColor is the hex RGB colour made transparent in the overlay. If
+	// empty, no colour is keyed out.
+	KeyColor string
+	// Similarity is how close to KeyColor a colour has to be to be keyed
+	// out, from 0 to 1. If zero, DefaultSimilarity is used.
+	Similarity float64
+}
+
+// DefaultSimilarity is the similarity used for keying if none is given.
+const DefaultSimilarity = 0.3
+
+// ParseKeyColor parses a hex RGB colour like "00ff00" or "#00ff00". The names
+// "green" and "blue" are accepted for the usual chroma key colours.
+func ParseKeyColor(s string) (string, error) {
+	switch s {
+	case "", "green":
+		return "00ff00", nil
+	case "blue":
+		return "0000ff", nil
+	}
+	s = strings.TrimPrefix(s, "#")
+	if _, err := strconv.ParseUint(s, 16, 32); err != nil || len(s) != 6 {
+		return "", fmt.Errorf("invalid colour %q", s)
+	}
+	return strings.ToLower(s), nil
+}
+
+// OverlayRect returns where an overlay of size ov is placed on a base of size
+// base, keeping the aspect ratio of the overlay.
+func OverlayRect(base, ov image.Point, opts OverlayOptions) image.Rectangle {
+	scale := opts.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	w := int(float64(base.X)*scale) &^ 1
+	h := int(float64(ov.Y)*float64(w)/float64(ov.X)) &^ 1
+	margin := base.X / 40
+	if scale >= 1 {
+		margin = 0
+	}
+	var x, y int
+	switch opts.Position {
+	case PositionTopLeft, PositionBottomLeft, PositionLeft:
+		x = margin
+	case PositionTopRight, PositionBottomRight, PositionRight:
+		x = base.X - w - margin
+	default:
+		x = (base.X - w) / 2
+	}
+	switch opts.Position {
+	case PositionTopLeft, PositionTopRight, PositionTop:
+		y = margin
+	case PositionBottomLeft, PositionBottomRight, PositionBottom:
+		y = base.Y - h - margin
+	default:
+		y = (base.Y - h) / 2
+	}
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// OverlayInput is an input to Overlay.
+type OverlayInput struct {
+	Name string
+	// Image is true if the input is a still image.
+	Image bool
+}
+
+// Overlay places ov on top of base, writing the result to the file at out in
+// the given format, either "mp4" or "gif". If ov is shorter than base, it's
+// looped. If base is an image, it's shown for as long as ov plays.
+func Overlay(base, ov OverlayInput, opts OverlayOptions, out, format string) error {
+	if base.Image && ov.Image {
+		return errors.New("can't overlay two images")
+	}
+	baseInfo, err := probeClip(base.Name)
+	if err != nil {
+		return fmt.Errorf("probing base: %w", err)
+	}
+	ovInfo, err := probeClip(ov.Name)
+	if err != nil {
+		return fmt.Errorf("probing overlay: %w", err)
+	}
+	baseIn := ff.Input{Name: base.Name}
+	ovIn := ff.Input{Name: ov.Name}
+	switch {
+	case base.Image && !ov.Image:
+		if ovInfo.duration == 0 {
+			return errors.New("couldn't determine the duration of the overlay")
+		}
+		baseIn.Options = []string{"-loop", "1",
+			"-t", fmt.Sprintf("%f", ovInfo.duration)}
+	case ov.Image:
+		ovIn.Options = []string{"-loop", "1"}
+	default:
+		ovIn.Options = []string{"-stream_loop", "-1"}
+	}
+	r := OverlayRect(image.Pt(baseInfo.width, baseInfo.height),
+		image.Pt(ovInfo.width, ovInfo.height), opts)
+	var o ff.Stream = ff.Filter(ff.Video(ovIn),
+		fmt.Sprintf("scale=%d:%d", r.Dx(), r.Dy()))
+	if opts.KeyColor != "" {
+		if opts.Similarity == 0 {
+			opts.Similarity = DefaultSimilarity
+		}
+		o = ff.Filter(o, fmt.Sprintf("format=rgba,colorkey=0x%s:%f:0.1",
+			opts.KeyColor, opts.Similarity))
+	}
+	var v ff.Stream = ff.Video(baseIn)
+	if base.Image {
+		v = ff.Filter(v, "pad=ceil(iw/2)*2:ceil(ih/2)*2")
+	}
+	v = ff.Overlay(v, o, r.Min.X, r.Min.Y)
+	streams := []ff.Stream{v}
+	if format == "gif" {
+		v = ff.Filter(v, "fps=20")
+		one, two := ff.Split(v)
+		palette := ff.PaletteGen(two)
+		streams[0] = ff.PaletteUse(one, palette)
+	} else {
+		streams[0] = ff.Filter(v, "format=yuv420p")
+		switch {
+		case !base.Image && baseInfo.hasAudio:
+			streams = append(streams, ff.Audio(baseIn))
+		case base.Image && ovInfo.hasAudio:
+			streams = append(streams, ff.Audio(ovIn))
+		}
+	}
+	fcmd := new(ff.Cmd)
+	fcmd.AddOutput(out, []string{"-f", format, "-shortest"}, streams...)
+	cmd := fcmd.Cmd()
+	cmd.Args = append(cmd.Args, "-y", "-loglevel", "error", "-shortest")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	return runFFmpeg(cmd, stderr)
+}
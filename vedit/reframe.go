@@ -0,0 +1,103 @@
+package vedit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ff "samhza.com/ffmpeg"
+)
+
+// Aspect is an aspect ratio, like 9:16.
+type Aspect struct {
+	W, H int
+}
+
+// ParseAspect parses an aspect ratio of the form "w:h".
+func ParseAspect(s string) (Aspect, error) {
+	sw, sh, ok := strings.Cut(s, ":")
+	if !ok {
+		return Aspect{}, errors.New("aspect ratio must look like 9:16")
+	}
+	w, err := strconv.Atoi(sw)
+	if err != nil {
+		return Aspect{}, err
+	}
+	h, err := strconv.Atoi(sh)
+	if err != nil {
+		return Aspect{}, err
+	}
+	if w <= 0 || h <= 0 {
+		return Aspect{}, errors.New("aspect ratio must be positive")
+	}
+	return Aspect{w, h}, nil
+}
+
+// ReframeSize returns the size of the largest frame with the given aspect
+// ratio which fits in a w by h frame.
+func ReframeSize(w, h int, aspect Aspect) (int, int) {
+	if w*aspect.H > h*aspect.W {
+		// the new frame is narrower than the old one
+		return (h * aspect.W / aspect.H) &^ 1, h &^ 1
+	}
+	return w &^ 1, (w * aspect.H / aspect.W) &^ 1
+}
+
+// fitSize returns the size a w by h frame is scaled to to fit in an nw by nh
+// one, keeping its aspect ratio.
+func fitSize(w, h, nw, nh int) (int, int) {
+	if w*nh > h*nw {
+		return nw, max(h*nw/w, 2) &^ 1
+	}
+	return max(w*nh/h, 2) &^ 1, nh
+}
+
+// reframeBlur is the boxblur used for the background of reframed videos.
+const reframeBlur = "boxblur=luma_radius=min(h\\,w)/20:luma_power=2"
+
+// reframe shrinks the w by h video v to fit centered in a frame of the given
+// aspect ratio no bigger than it, over a blurred copy of itself zoomed in to
+// fill the frame. It returns the reframed video and its size.
+func reframe(v ff.Stream, w, h int, aspect Aspect) (ff.Stream, int, int) {
+	nw, nh := ReframeSize(w, h, aspect)
+	fw, fh := fitSize(w, h, nw, nh)
+	bg, fg := ff.Split(v)
+	bg = ff.Filter(bg, fmt.Sprintf(
+		"scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d,",
+		nw, nh, nw, nh)+reframeBlur+",setsar=1")
+	fg = ff.Filter(fg, fmt.Sprintf("scale=%d:%d,setsar=1", fw, fh))
+	return ff.Overlay(bg, fg, (nw-fw)/2, (nh-fh)/2), nw, nh
+}
+
+// Reframe reframes the video or GIF at in to the given aspect ratio like the
+// reframe edit does, writing the result to the file at out in the given
+// format, either "mp4" or "gif".
+func Reframe(in string, aspect Aspect, out, format string) error {
+	info, err := probeClip(in)
+	if err != nil {
+		return err
+	}
+	input := ff.Input{Name: in}
+	v, _, _ := reframe(ff.Video(input), info.width, info.height, aspect)
+	streams := []ff.Stream{v}
+	if format == "gif" {
+		v = ff.Filter(v, "fps=20")
+		one, two := ff.Split(v)
+		palette := ff.PaletteGen(two)
+		streams[0] = ff.PaletteUse(one, palette)
+	} else {
+		streams[0] = ff.Filter(v, "format=yuv420p")
+		if info.hasAudio {
+			streams = append(streams, ff.Audio(input))
+		}
+	}
+	fcmd := new(ff.Cmd)
+	fcmd.AddOutput(out, []string{"-f", format}, streams...)
+	cmd := fcmd.Cmd()
+	cmd.Args = append(cmd.Args, "-y", "-loglevel", "error")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	return runFFmpeg(cmd, stderr)
+}
@@ -0,0 +1,145 @@
+package vedit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Layout is how Stack arranges its inputs.
+type Layout int
+
+const (
+	// LayoutHorizontal puts inputs side by side, scaled to the same height.
+	LayoutHorizontal Layout = iota
+	// LayoutVertical puts inputs on top of each other, scaled to the same
+	// width.
+	LayoutVertical
+	// LayoutGrid puts inputs in a grid of equally sized cells.
+	LayoutGrid
+)
+
+// GridSize returns the number of columns and rows of a grid holding n items.
+func GridSize(n int) (cols, rows int) {
+	cols = int(math.Ceil(math.Sqrt(float64(n))))
+	rows = (n + cols - 1) / cols
+	return cols, rows
+}
+
+// StackInput is an input to Stack.
+type StackInput struct {
+	Name string
+	// Image is true if the input is a still image.
+	Image bool
+}
+
+type StackOptions struct {
+	Layout Layout
+	// Audio lists the indexes of the inputs whose audio is mixed into the
+	// output. If nil, the audio of every input is used.
+	Audio []int
+	// GIF makes Stack output a GIF instead of an mp4.
+	GIF bool
+}
+
+// Stack combines inputs into one video according to opts, writing it to the
+// file at out. Videos are played at the same time, with shorter ones holding
+// their last frame until the longest one ends. The size of the cells is
+// taken from the first input.
+func Stack(inputs []StackInput, opts StackOptions, out string) error {
+	if len(inputs) < 2 {
+		return errors.New("need at least 2 inputs")
+	}
+	infos := make([]clipInfo, len(inputs))
+	var dur float64
+	for i, input := range inputs {
+		var err error
+		infos[i], err = probeClip(input.Name)
+		if err != nil {
+			return fmt.Errorf("probing input %d: %w", i+1, err)
+		}
+		if !input.Image {
+			dur = math.Max(dur, infos[i].duration)
+		}
+	}
+	if dur == 0 {
+		return errors.New("couldn't determine the duration of the output")
+	}
+	w, h := infos[0].width&^1, infos[0].height&^1
+
+	g := new(graph)
+	vs := make([]string, len(inputs))
+	var as []string
+	useAudio := make([]bool, len(inputs))
+	if opts.Audio == nil {
+		for i := range useAudio {
+			useAudio[i] = true
+		}
+	}
+	for _, i := range opts.Audio {
+		if i < 0 || i >= len(inputs) {
+			return fmt.Errorf("there is no input %d to take audio from", i+1)
+		}
+		useAudio[i] = true
+	}
+	for i, input := range inputs {
+		var in int
+		if input.Image {
+			in = g.input(input.Name, "-loop", "1", "-t", fmt.Sprintf("%f", dur))
+		} else {
+			in = g.input(input.Name)
+		}
+		v := stream(in, "v")
+		if !input.Image && infos[i].duration < dur {
+			v = g.filter(fmt.Sprintf("tpad=stop_mode=clone:stop_duration=%f",
+				dur-infos[i].duration), v)
+		}
+		switch opts.Layout {
+		case LayoutHorizontal:
+			v = g.filter(fmt.Sprintf("scale=-2:%d,setsar=1", h), v)
+		case LayoutVertical:
+			v = g.filter(fmt.Sprintf("scale=%d:-2,setsar=1", w), v)
+		case LayoutGrid:
+			v = fitFrame(g, v, w, h, FitLetterbox)
+		}
+		vs[i] = g.filter("fps=30,format=yuv420p", v)
+		if useAudio[i] && infos[i].hasAudio && !input.Image {
+			as = append(as, stream(in, "a"))
+		}
+	}
+
+	var v string
+	switch opts.Layout {
+	case LayoutHorizontal:
+		v = g.filter(fmt.Sprintf("hstack=inputs=%d", len(vs)), vs...)
+	case LayoutVertical:
+		v = g.filter(fmt.Sprintf("vstack=inputs=%d", len(vs)), vs...)
+	case LayoutGrid:
+		cols, _ := GridSize(len(vs))
+		layout := make([]string, len(vs))
+		for i := range vs {
+			layout[i] = fmt.Sprintf("%d_%d", (i%cols)*w, (i/cols)*h)
+		}
+		v = g.filter(fmt.Sprintf("xstack=inputs=%d:layout=%s:fill=black",
+			len(vs), strings.Join(layout, "|")), vs...)
+	}
+
+	outopts := []string{"-t", fmt.Sprintf("%f", dur)}
+	if opts.GIF {
+		vs := g.filterN("fps=20,split", 2, v)
+		palette := g.filter("palettegen", vs[1])
+		v = g.filter("paletteuse", vs[0], palette)
+		return g.run(out, append(outopts, "-f", "gif"), v)
+	}
+	streams := []string{v}
+	switch len(as) {
+	case 0:
+	case 1:
+		streams = append(streams, as[0])
+	default:
+		streams = append(streams, g.filter(
+			fmt.Sprintf("amix=inputs=%d:duration=longest", len(as)), as...))
+	}
+	return g.run(out, append(outopts, "-f", "mp4"), streams...)
+}
@@ -6,16 +6,16 @@ import (
 	"fmt"
 	"image"
 	"image/png"
+	"math"
 	"net/url"
 	"os"
 	"os/exec"
 	"strconv"
 	"strings"
 
-	"github.com/kkdai/youtube/v2"
+	"samhza.com/esammy/imagefx"
 	"samhza.com/esammy/memegen"
 	ff "samhza.com/ffmpeg"
-	"samhza.com/ytsearch"
 )
 
 type Arguments struct {
@@ -33,8 +33,15 @@ type Arguments struct {
 	fadeout      float64
 	musicskip    float64
 	musicdelay   float64
+	musicvolume  *float64
+	origvolume   *float64
+	musicfade    float64
+	musicloop    bool
+	duck         duckMode
 	length       int
 	fadeinstart  float64
+	afadein      float64
+	afadeout     float64
 	areverse     bool
 	reverse      bool
 	vreverse     bool
@@ -42,6 +49,15 @@ type Arguments struct {
 	mute         bool
 	muffle       bool
 	vibrato      bool
+	nonorm       bool
+	reframe      *Aspect
+	motion       *motion
+	shake        float64
+	zoomshake    float64
+	glitch       float64
+	datamosh     float64
+	seed         int
+	frameFX      imagefx.Chain
 }
 
 func parseTimestamp(str string) (float64, error) {
@@ -118,6 +134,23 @@ func (v *Arguments) Parse(args string) error {
 			v.musicskip, err = parseTimestamp(arg)
 		case "musicdelay":
 			v.musicdelay, err = parseTimestamp(arg)
+		case "musicvolume":
+			var volume float64
+			volume, err = strconv.ParseFloat(arg, 64)
+			v.musicvolume = &volume
+		case "origvolume":
+			var volume float64
+			volume, err = strconv.ParseFloat(arg, 64)
+			v.origvolume = &volume
+		case "musicfade":
+			v.musicfade = 2
+			if arg != "" {
+				v.musicfade, err = strconv.ParseFloat(arg, 64)
+			}
+		case "musicloop":
+			v.musicloop = true
+		case "duck":
+			v.duck, err = parseDuck(arg)
 		case "length":
 			v.length, err = strconv.Atoi(arg)
 		case "spin":
@@ -127,9 +160,13 @@ func (v *Arguments) Parse(args string) error {
 		case "fadeinstart":
 			v.fadeinstart, err = parseTimestamp(arg)
 		case "fadeout":
-			v.fadein, err = strconv.ParseFloat(arg, 64)
+			v.fadeout, err = strconv.ParseFloat(arg, 64)
 		case "fadeoutstart":
 			v.fadeoutstart, err = parseTimestamp(arg)
+		case "afadein":
+			v.afadein, err = strconv.ParseFloat(arg, 64)
+		case "afadeout":
+			v.afadeout, err = strconv.ParseFloat(arg, 64)
 		case "tt":
 			v.tt = arg
 		case "bt":
@@ -140,6 +177,28 @@ func (v *Arguments) Parse(args string) error {
 			v.reverb = true
 		case "muffle":
 			v.muffle = true
+		case "nonorm":
+			v.nonorm = true
+		case "shake":
+			v.shake, err = parseIntensity(arg)
+		case "zoomshake":
+			v.zoomshake, err = parseIntensity(arg)
+		case "glitch":
+			v.glitch, err = parseIntensity(arg)
+		case "datamosh":
+			v.datamosh, err = parseIntensity(arg)
+		case "seed":
+			v.seed, err = strconv.Atoi(arg)
+		case "zoom", "pan", "kenburns":
+			v.motion, err = parseMotion(cmd, arg)
+		case "pixelsort", "dither":
+			var e imagefx.Effect
+			e, err = imagefx.Parse(cmd + " " + arg)
+			v.frameFX = append(v.frameFX, e)
+		case "reframe":
+			var aspect Aspect
+			aspect, err = ParseAspect(arg)
+			v.reframe = &aspect
 		default:
 			err = errors.New("unknown command")
 		}
@@ -152,6 +211,11 @@ func (v *Arguments) Parse(args string) error {
 	return err
 }
 
+// Normalize reports whether the loudness of the output should be normalized.
+func (v *Arguments) Normalize() bool {
+	return !v.nonorm
+}
+
 type InputType int
 
 const (
@@ -159,7 +223,9 @@ const (
 	InputImage
 )
 
-func Process(arg Arguments, itype InputType, in, out *os.File) error {
+// Process applies the edits described by arg to in, writing an mp4 to out.
+// Music is looked up using the given resolver.
+func Process(arg Arguments, itype InputType, in, out *os.File, mr MusicResolver) error {
 	probed, err := ff.ProbeReader(in)
 	if err != nil {
 		return err
@@ -179,6 +245,13 @@ func Process(arg Arguments, itype InputType, in, out *os.File) error {
 			hasAudio = true
 		}
 	}
+	if d, err := strconv.ParseFloat(inDur, 64); itype != InputImage && (err != nil || d <= 0) {
+		// streams of containers like WebM and Matroska don't have
+		// durations of their own
+		if d = probeFormatDuration(in.Name()); d > 0 {
+			inDur = strconv.FormatFloat(d, 'f', -1, 64)
+		}
+	}
 	var v, a ff.Stream
 	instream := ff.InputFile{File: in}
 	if itype == InputImage {
@@ -223,24 +296,33 @@ func Process(arg Arguments, itype InputType, in, out *os.File) error {
 	if arg.vibrato {
 		a = ff.Filter(a, "vibrato")
 	}
+	if arg.motion != nil {
+		untimed := arg
+		untimed.speed = nil
+		dur, err := outputDuration(untimed, itype, inDur)
+		if err != nil && arg.motion.dur == 0 {
+			return fmt.Errorf("finding how long to move for: %w", err)
+		}
+		v = arg.motion.apply(v, width, height, dur, itype == InputImage)
+	}
 	if arg.music != "" {
-		music, err := getMusicURL(arg.music)
+		if mr == nil {
+			return errors.New("music isn't available")
+		}
+		music, err := mr.ResolveMusic(arg.music)
 		if err != nil {
 			return err
 		}
-		mus := ff.Audio(ff.Input{Name: music, Options: []string{
-			"-ss", fmt.Sprintf("%v", arg.musicskip),
-			"-t", "600", // lets limit it to 10 minutes
-		}})
-		if arg.musicdelay > 0 {
-			part1, part2 := ff.ASplit(a)
-			part1 = ff.Filter(part1, fmt.Sprintf("atrim=end=%f,asetpts=PTS-STARTPTS", arg.musicdelay))
-			part2 = ff.Filter(part2, fmt.Sprintf("atrim=start=%f,asetpts=PTS-STARTPTS", arg.musicdelay))
-			part2 = ff.AMix(mus, part2)
-			a = ff.Concat(0, 1, part1, part2)[0]
-		} else {
-			a = ff.AMix(mus, a)
+		mixed, err := mixMusic(a, music, arg)
+		if err != nil {
+			return err
 		}
+		defer os.Remove(mixed.Name())
+		defer mixed.Close()
+		if _, err = in.Seek(0, 0); err != nil {
+			return err
+		}
+		a = ff.Audio(ff.InputFile{File: mixed})
 	}
 	if arg.muffle {
 		a = ff.Filter(a, "lowpass=300")
@@ -252,6 +334,9 @@ func Process(arg Arguments, itype InputType, in, out *os.File) error {
 		v = ff.MultiplyPTS(v, float64(1) / *arg.speed)
 		a = ff.ATempo(a, *arg.speed)
 	}
+	if arg.reframe != nil {
+		v, width, height = reframe(v, width, height, *arg.reframe)
+	}
 	if arg.tt != "" || arg.bt != "" {
 		m := image.NewRGBA(image.Rect(0, 0, width, height))
 		memegen.Impact(m, arg.tt, arg.bt)
@@ -270,6 +355,20 @@ func Process(arg Arguments, itype InputType, in, out *os.File) error {
 		}
 		defer cancel()
 		v = ff.Overlay(imginput, v, -pt.X, -pt.Y)
+		width, height = image.Bounds().Dx(), image.Bounds().Dy()
+	}
+	if arg.datamosh > 0 {
+		v = datamosh(v, arg.datamosh)
+	}
+	if arg.glitch > 0 {
+		v = glitch(v, arg.glitch, arg.seed)
+	}
+	if arg.zoomshake > 0 {
+		v = zoomshake(v, width, height, arg.zoomshake, arg.seed)
+		a = ff.Filter(a, "bass=g=10")
+	}
+	if arg.shake > 0 {
+		v = shake(v, arg.shake, arg.seed)
 	}
 	if arg.volume != nil {
 		a = ff.Volume(a, *arg.volume)
@@ -277,26 +376,71 @@ func Process(arg Arguments, itype InputType, in, out *os.File) error {
 	if arg.spin > 0 {
 		v = ff.Filter(v, "rotate=t*"+strconv.Itoa(arg.spin))
 	}
+	var fadein, fadeout float64
 	if arg.fadein > 0 || arg.fadeinstart > 0 {
-		fadein := arg.fadein
+		fadein = arg.fadein
 		if fadein == 0 {
 			fadein = 5
 		}
 		v = ff.Filter(v, fmt.Sprintf("fade=in:duration=%f:start_time=%f", fadein, arg.fadeinstart))
 	}
-	if arg.fadeout > 0 || arg.fadeoutstart > 0 {
-		fadeout := arg.fadeout
-		if fadeout == 0 {
-			fadeout = 5
+	if afadein := arg.afadein; afadein > 0 || fadein > 0 {
+		if afadein == 0 {
+			afadein = fadein
 		}
-		v = ff.Filter(v, fmt.Sprintf("fade=out:duration=%f:start_time=%f", fadeout, arg.fadeoutstart))
+		a = ff.Filter(a, fmt.Sprintf("afade=t=in:d=%f:st=%f", afadein, arg.fadeinstart))
+	}
+	if arg.fadeout > 0 || arg.fadeoutstart > 0 || arg.afadeout > 0 {
+		var outDur float64
+		if arg.fadeoutstart == 0 {
+			outDur, err = outputDuration(arg, itype, inDur)
+			if err != nil {
+				return fmt.Errorf("finding where to fade out: %w", err)
+			}
+		}
+		// fadeoutStart returns when a fade of the given duration should
+		// start, which is at the end of the output unless the user asked
+		// for a specific time.
+		fadeoutStart := func(d float64) float64 {
+			if arg.fadeoutstart > 0 {
+				return arg.fadeoutstart
+			}
+			return math.Max(outDur-d, 0)
+		}
+		if arg.fadeout > 0 || arg.fadeoutstart > 0 {
+			fadeout = arg.fadeout
+			if fadeout == 0 {
+				fadeout = 5
+			}
+			v = ff.Filter(v, fmt.Sprintf("fade=out:duration=%f:start_time=%f", fadeout, fadeoutStart(fadeout)))
+		}
+		afadeout := arg.afadeout
+		if afadeout == 0 {
+			afadeout = fadeout
+		}
+		a = ff.Filter(a, fmt.Sprintf("afade=t=out:d=%f:st=%f", afadeout, fadeoutStart(afadeout)))
+	}
+	dst := out
+	if len(arg.frameFX) > 0 {
+		// the frames are run through the effects after everything else is
+		// done, so the output of FFmpeg is kept for that
+		dst, err = os.CreateTemp("", "esammy.*.mp4")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(dst.Name())
+		defer dst.Close()
 	}
 	fcmd := &ff.Cmd{}
 	outopts := []string{"-f", "mp4", "-shortest"}
 	if itype == InputVideo && ff.IsInputStream(v) {
 		outopts = append(outopts, "-c:v", "copy")
+	} else {
+		// filters like geq leave frames in formats which libx264 would
+		// otherwise encode in profiles players can't play
+		outopts = append(outopts, "-pix_fmt", "yuv420p")
 	}
-	fcmd.AddFileOutput(out, outopts, v, a)
+	fcmd.AddFileOutput(dst, outopts, v, a)
 	cmd := fcmd.Cmd()
 	cmd.Args = append(cmd.Args, "-y", "-loglevel", "error", "-shortest")
 	stderr := &bytes.Buffer{}
@@ -310,9 +454,38 @@ func Process(arg Arguments, itype InputType, in, out *os.File) error {
 		}
 		return err
 	}
+	if len(arg.frameFX) > 0 {
+		return filterFrames(dst.Name(), out.Name(), arg.frameFX)
+	}
 	return nil
 }
 
+// outputDuration calculates how long the output of Process will be in
+// seconds, taking trimming and speed changes into account.
+func outputDuration(arg Arguments, itype InputType, inDur string) (float64, error) {
+	var dur float64
+	if itype == InputImage {
+		dur = float64(arg.length)
+	} else {
+		var err error
+		dur, err = strconv.ParseFloat(inDur, 64)
+		if err != nil {
+			return 0, errors.New("couldn't determine the input's duration")
+		}
+	}
+	if arg.end > 0 && arg.end < dur {
+		dur = arg.end
+	}
+	dur -= arg.start
+	if arg.speed != nil {
+		dur /= *arg.speed
+	}
+	if dur <= 0 {
+		return 0, errors.New("output is empty")
+	}
+	return dur, nil
+}
+
 func imageInput(img image.Image) (stream ff.Stream, cancel func(), err error) {
 	pR, pW, err := os.Pipe()
 	if err != nil {
@@ -364,35 +537,3 @@ func probeSize(file *os.File) (width, height int, err error) {
 
 	return width, height, nil
 }
-
-func getMusicURL(music string) (string, error) {
-	ytc := new(youtube.Client)
-	vid, err := ytc.GetVideo(music)
-	if err != nil {
-		results, err := ytsearch.Search(music)
-		if err != nil {
-			return "", fmt.Errorf("searching: %w", err)
-		}
-		if len(results) == 0 {
-			return "", fmt.Errorf("no search results")
-		}
-		vid, err = ytc.GetVideo(results[0].ID)
-		if err != nil {
-			return "", fmt.Errorf("fetching video: %w", err)
-		}
-	}
-	var format *youtube.Format
-Outer:
-	for _, fmt := range vid.Formats {
-		switch fmt.ItagNo {
-		case 249, 250, 251:
-			fmt := fmt
-			format = &fmt
-			break Outer
-		}
-	}
-	if format == nil {
-		return "", fmt.Errorf("audio stream for video not found")
-	}
-	return ytc.GetStreamURL(vid, format)
-}
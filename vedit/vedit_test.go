@@ -0,0 +1,123 @@
+package vedit
+
+import "testing"
+
+func TestOutputDuration(t *testing.T) {
+	speed := 2.0
+	tests := []struct {
+		name  string
+		arg   Arguments
+		itype InputType
+		inDur string
+		want  float64
+	}{
+		{"video", Arguments{}, InputVideo, "10.5", 10.5},
+		{"image", Arguments{length: 15}, InputImage, "", 15},
+		{"trimmed", Arguments{start: 2, end: 8}, InputVideo, "10", 6},
+		{"end past input", Arguments{end: 20}, InputVideo, "10", 10},
+		{"sped up", Arguments{start: 2, speed: &speed}, InputVideo, "10", 4},
+	}
+	for _, tt := range tests {
+		got, err := outputDuration(tt.arg, tt.itype, tt.inDur)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if _, err := outputDuration(Arguments{}, InputVideo, ""); err == nil {
+		t.Error("expected error for unknown duration")
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		in         string
+		start, end float64
+		ok         bool
+	}{
+		{"5", 0, 5, true},
+		{"2-5", 2, 5, true},
+		{"1:00-1:10.5", 60, 70.5, true},
+		{"3-", 3, 0, true},
+		{"-4", 0, 4, true},
+		{"5-2", 0, 0, false},
+		{"https://example.com/a-b.mp4", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, end, err := ParseRange(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseRange(%q): unexpected error %v", tt.in, err)
+			continue
+		}
+		if start != tt.start || end != tt.end {
+			t.Errorf("ParseRange(%q) = %v, %v; want %v, %v",
+				tt.in, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestReframeSize(t *testing.T) {
+	tests := []struct {
+		w, h   int
+		aspect Aspect
+		nw, nh int
+	}{
+		{1920, 1080, Aspect{9, 16}, 606, 1080},
+		{1080, 1920, Aspect{16, 9}, 1080, 606},
+		{1280, 720, Aspect{1, 1}, 720, 720},
+		{720, 1280, Aspect{1, 1}, 720, 720},
+		{500, 500, Aspect{1, 1}, 500, 500},
+		{1080, 1920, Aspect{9, 16}, 1080, 1920},
+	}
+	for _, tt := range tests {
+		nw, nh := ReframeSize(tt.w, tt.h, tt.aspect)
+		if nw != tt.nw || nh != tt.nh {
+			t.Errorf("ReframeSize(%d, %d, %v) = %d, %d; want %d, %d",
+				tt.w, tt.h, tt.aspect, nw, nh, tt.nw, tt.nh)
+		}
+	}
+}
+
+func TestParseMotion(t *testing.T) {
+	m, err := parseMotion("zoom", "out 3 easein")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.dir != "out" || m.dur != 3 || m.easing != "easein" {
+		t.Errorf("got %+v", *m)
+	}
+	m, err = parseMotion("kenburns", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.dur != 0 || m.easing != "easeinout" {
+		t.Errorf("got %+v", *m)
+	}
+	for _, args := range [][2]string{
+		{"zoom", ""},
+		{"zoom", "left"},
+		{"pan", "in"},
+		{"pan", "left fast"},
+		{"kenburns", "-2"},
+	} {
+		if _, err := parseMotion(args[0], args[1]); err == nil {
+			t.Errorf("parseMotion(%q, %q): expected error", args[0], args[1])
+		}
+	}
+}
+
+func TestParseFrameFX(t *testing.T) {
+	var arg Arguments
+	if err := arg.Parse("speed 2, pixelsort hue vertical, dither gameboy ordered"); err != nil {
+		t.Fatal(err)
+	}
+	if len(arg.frameFX) != 2 {
+		t.Errorf("got %d frame effects, want 2", len(arg.frameFX))
+	}
+	if err := arg.Parse("dither rainbow"); err == nil {
+		t.Error("expected error for unknown palette")
+	}
+}